@@ -6,5 +6,8 @@ require (
         github.com/gorilla/schema v1.2.0
         github.com/sirupsen/logrus v1.8.1
         go.k6.io/k6 v0.45.1
+        go.opentelemetry.io/proto/otlp v0.19.0
+        google.golang.org/protobuf v1.31.0
+        gopkg.in/yaml.v3 v3.0.1
 
 )
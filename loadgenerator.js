@@ -47,6 +47,15 @@ export const options = {
     discardResponseBodies: true,
     vus: 70,
     duration: '10m',
+    ext: {
+        dynatrace: {
+            dimensions: {
+                test: 'hipster-shop',
+            },
+            keepUrlTag: false,
+            keepNameTag: true,
+        },
+    },
 };
 
 export default function() {
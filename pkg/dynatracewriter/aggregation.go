@@ -0,0 +1,145 @@
+package dynatracewriter
+
+import (
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// gaugeSummary is the min, max, sum and count of the values of a series within an aggregation window.
+type gaugeSummary struct {
+	min   float64
+	max   float64
+	sum   float64
+	count int
+}
+
+func (s *gaugeSummary) add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.sum += value
+	s.count++
+}
+
+// aggregationWindow holds the samples of one window until it is closed.
+type aggregationWindow struct {
+	start   time.Time
+	samples []metrics.SampleContainer
+}
+
+// windowAggregator assigns the samples to windows aligned to wall-clock boundaries, e.g. full minutes,
+// independently of how often the output flushes. A window is closed one flush period after its end,
+// so the samples which were buffered by k6 around the end still make it into the window.
+type windowAggregator struct {
+	size        time.Duration
+	grace       time.Duration
+	windows     map[time.Time]*aggregationWindow
+	closedUntil time.Time
+}
+
+func newWindowAggregator(size, grace time.Duration) *windowAggregator {
+	return &windowAggregator{size: size, grace: grace, windows: make(map[time.Time]*aggregationWindow)}
+}
+
+// add assigns every sample container to the window of its time. Containers of windows which are
+// already closed go to the first open window, they are sent late rather than as a second data point.
+func (a *windowAggregator) add(samplesContainers []metrics.SampleContainer) {
+	for _, samplesContainer := range samplesContainers {
+		samples := samplesContainer.GetSamples()
+		if len(samples) == 0 {
+			continue
+		}
+		start := samples[0].Time.Truncate(a.size)
+		if start.Before(a.closedUntil) {
+			start = a.closedUntil
+		}
+		window, ok := a.windows[start]
+		if !ok {
+			window = &aggregationWindow{start: start}
+			a.windows[start] = window
+		}
+		window.samples = append(window.samples, samplesContainer)
+	}
+}
+
+// closed removes and returns the windows which ended at least the grace period before now, oldest first.
+func (a *windowAggregator) closed(now time.Time) []*aggregationWindow {
+	var closed []*aggregationWindow
+	for start, window := range a.windows {
+		if !start.Add(a.size + a.grace).After(now) {
+			closed = append(closed, window)
+			delete(a.windows, start)
+			if end := start.Add(a.size); end.After(a.closedUntil) {
+				a.closedUntil = end
+			}
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].start.Before(closed[j].start) })
+	return closed
+}
+
+// drain removes and returns all the windows, at the end of the test.
+func (a *windowAggregator) drain() []*aggregationWindow {
+	var latest time.Time
+	for start := range a.windows {
+		if start.After(latest) {
+			latest = start
+		}
+	}
+	return a.closed(latest.Add(a.size + a.grace))
+}
+
+// aggregateWindow combines the converted samples of a window to one data point per series, timestamped
+// with the start of the window: counters as the sum of their values, all other metrics as gauge summary.
+func aggregateWindow(dynatraceMetrics []dynatraceMetric, start time.Time) []dynatraceMetric {
+	type series struct {
+		metric  dynatraceMetric
+		summary *gaugeSummary
+	}
+	byKey := make(map[string]*series)
+	var keys []string
+	for _, m := range dynatraceMetrics {
+		key := seriesKey(m.metricKeyName, m.metricDimensions)
+		s, ok := byKey[key]
+		if !ok {
+			s = &series{metric: m, summary: &gaugeSummary{}}
+			byKey[key] = s
+			keys = append(keys, key)
+		}
+		s.summary.add(m.metricValue)
+	}
+	sort.Strings(keys)
+
+	aggregated := make([]dynatraceMetric, 0, len(keys))
+	for _, key := range keys {
+		s := byKey[key]
+		m := s.metric
+		m.metricTimeStamp = start.UnixMilli()
+		if m.metricType == metrics.Counter {
+			// the same payload type as without a window, only the value covers the whole window
+			m.metricValue = s.summary.sum
+		} else {
+			m.metricValue = s.summary.sum / float64(s.summary.count)
+			m.metricSummary = s.summary
+		}
+		aggregated = append(aggregated, m)
+	}
+	return aggregated
+}
+
+// sendWindow converts, aggregates and sends the samples of a closed window and returns the number of series sent.
+func (o *Output) sendWindow(window *aggregationWindow) int {
+	converted := o.convertToTimeDynatraceData(window.samples)
+	dynatraceMetrics := aggregateWindow(converted, window.start)
+	dynatraceMetrics = append(dynatraceMetrics, o.deriveMetrics(window.samples, converted, window.start)...)
+	if len(dynatraceMetrics) > 0 {
+		o.logger.WithField("nts", len(dynatraceMetrics)).Debug("Aggregated the window starting at " + window.start.String())
+		o.recordFlush(o.sendMetrics(dynatraceMetrics))
+	}
+	return len(dynatraceMetrics)
+}
@@ -0,0 +1,60 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestWindowAggregator(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	reqs := registry.MustNewMetric("http_reqs", metrics.Counter)
+	sample := func(at time.Time) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: registry.RootTagSet()}, Time: at, Value: 1}
+	}
+
+	base := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	a := newWindowAggregator(time.Minute, time.Second)
+	a.add([]metrics.SampleContainer{sample(base.Add(10 * time.Second)), sample(base.Add(59 * time.Second)), sample(base.Add(61 * time.Second))})
+
+	// the first window stays open for the grace period after its end
+	assert.Empty(t, a.closed(base.Add(60*time.Second)))
+	closed := a.closed(base.Add(61 * time.Second))
+	require.Len(t, closed, 1)
+	assert.Equal(t, base, closed[0].start)
+	assert.Len(t, closed[0].samples, 2)
+
+	// a late sample of the closed window goes to the next one
+	a.add([]metrics.SampleContainer{sample(base.Add(59 * time.Second))})
+	closed = a.drain()
+	require.Len(t, closed, 1)
+	assert.Equal(t, base.Add(time.Minute), closed[0].start)
+	assert.Len(t, closed[0].samples, 2)
+}
+
+func TestAggregateWindow(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	dims := map[string]string{"scenario": "default"}
+	aggregated := aggregateWindow([]dynatraceMetric{
+		{metricKeyName: "http_reqs", metricType: metrics.Counter, metricValue: 1, metricDimensions: dims},
+		{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: 100, metricDimensions: dims},
+		{metricKeyName: "http_reqs", metricType: metrics.Counter, metricValue: 1, metricDimensions: dims},
+		{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: 300, metricDimensions: dims},
+		{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: 200, metricDimensions: map[string]string{"scenario": "other"}},
+	}, start)
+
+	require.Len(t, aggregated, 3)
+	assert.Regexp(t, `^k6\.http_req_duration,scenario="default" .*gauge,min=100,max=300,sum=400,count=2 1685620800000$`, aggregated[0].toText())
+	assert.Regexp(t, `^k6\.http_req_duration,scenario="other" .*gauge,min=200,max=200,sum=200,count=1 1685620800000$`, aggregated[1].toText())
+	// counters keep the payload type they have without a window
+	assert.Regexp(t, `^k6\.http_reqs,scenario="default" +2 1685620800000$`, aggregated[2].toText())
+	plain := dynatraceMetric{metricKeyName: "http_reqs", metricType: metrics.Counter, metricValue: 2, metricDimensions: dims, metricTimeStamp: start.UnixMilli()}
+	assert.Equal(t, plain.toText(), aggregated[2].toText())
+}
@@ -0,0 +1,157 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	apdexMetric        = "apdex"
+	availabilityMetric = "sli.availability"
+)
+
+// sliOutcomeTags tell the outcome of a request. They are no dimensions of the SLIs, otherwise every series
+// only has successful or only failed requests and its availability is always 0 or 100.
+var sliOutcomeTags = []string{"expected_response", "status", "error_code", "error"}
+
+// apdexThresholds are the response times up to which a request is satisfied or tolerated.
+type apdexThresholds struct {
+	satisfied  time.Duration
+	tolerating time.Duration
+}
+
+// parseApdexThresholds parses the thresholds of one request name, e.g. 300ms,1.2s.
+func parseApdexThresholds(s string) (apdexThresholds, error) {
+	satisfied, tolerating, ok := strings.Cut(s, ",")
+	if !ok {
+		return apdexThresholds{}, fmt.Errorf("expected <satisfied>,<tolerating> like 300ms,1.2s, got %q", s)
+	}
+	var (
+		t   apdexThresholds
+		err error
+	)
+	if t.satisfied, err = time.ParseDuration(strings.TrimSpace(satisfied)); err != nil {
+		return apdexThresholds{}, err
+	}
+	if t.tolerating, err = time.ParseDuration(strings.TrimSpace(tolerating)); err != nil {
+		return apdexThresholds{}, err
+	}
+	if t.satisfied <= 0 || t.tolerating < t.satisfied {
+		return apdexThresholds{}, fmt.Errorf("the satisfied threshold must be greater than 0 and not greater than the tolerating one, got %q", s)
+	}
+	return t, nil
+}
+
+// apdexThresholds returns the thresholds of a request name, the global ones if the name has none.
+func (o *Output) apdexThresholds(name string) apdexThresholds {
+	if perName, ok := o.config.ApdexThresholds[name]; ok {
+		if t, err := parseApdexThresholds(perName); err == nil {
+			return t
+		}
+	}
+	return apdexThresholds{
+		satisfied:  time.Duration(o.config.ApdexSatisfied.Duration),
+		tolerating: time.Duration(o.config.ApdexTolerating.Duration),
+	}
+}
+
+// sliDimensions returns the dimensions of the request for the SLIs, without the outcome tags.
+// The two SLIs share their series, they are limited together under the key of the Apdex.
+func (o *Output) sliDimensions(tags map[string]string) map[string]string {
+	withoutOutcome := make(map[string]string, len(tags))
+	for k, v := range tags {
+		withoutOutcome[k] = v
+	}
+	for _, k := range sliOutcomeTags {
+		delete(withoutOutcome, k)
+	}
+	return o.cardinality.limit(int(o.config.MaxSeriesPerMetric.Int64), apdexMetric, o.dimensions(withoutOutcome), o.config.Dimensions)
+}
+
+// sliSeries accumulates the requests of one set of dimensions within a flush.
+type sliSeries struct {
+	dimensions map[string]string
+	satisfied  int
+	tolerating int
+	total      int
+	checked    int
+	failed     int
+}
+
+// apdexMetrics computes the Apdex from http_req_duration and the availability from http_req_failed per flush
+// and set of dimensions. Failed requests count as frustrated. The thresholds are chosen by the name tag
+// of the request, also when the name is not kept as dimension. Both gauges are subject to the metric filter.
+func (o *Output) apdexMetrics(samplesContainers []metrics.SampleContainer, now time.Time) []dynatraceMetric {
+	series := make(map[string]*sliSeries)
+	var keys []string
+	seriesOf := func(dimensions map[string]string) *sliSeries {
+		key := seriesKey("", dimensions)
+		s, ok := series[key]
+		if !ok {
+			s = &sliSeries{dimensions: dimensions}
+			series[key] = s
+			keys = append(keys, key)
+		}
+		return s
+	}
+
+	for _, samplesContainer := range samplesContainers {
+		for _, sample := range samplesContainer.GetSamples() {
+			switch sample.Metric.Name {
+			case "http_req_duration":
+				tags := sample.GetTags().Map()
+				s := seriesOf(o.sliDimensions(tags))
+				s.total++
+				if tags["expected_response"] == "false" {
+					continue
+				}
+				t := o.apdexThresholds(tags["name"])
+				duration := time.Duration(sample.Value * float64(time.Millisecond))
+				if duration <= t.satisfied {
+					s.satisfied++
+				} else if duration <= t.tolerating {
+					s.tolerating++
+				}
+			case "http_req_failed":
+				s := seriesOf(o.sliDimensions(sample.GetTags().Map()))
+				s.checked++
+				if sample.Value != 0 {
+					s.failed++
+				}
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	sendApdex := o.metricFilter.allowsName(apdexMetric, metrics.Gauge)
+	sendAvailability := o.metricFilter.allowsName(availabilityMetric, metrics.Gauge)
+	var sliMetrics []dynatraceMetric
+	for _, key := range keys {
+		s := series[key]
+		if s.total > 0 && sendApdex {
+			sliMetrics = append(sliMetrics, dynatraceMetric{
+				metricKeyPrefix:  o.config.MetricPrefix.String,
+				metricKeyName:    apdexMetric,
+				metricDimensions: s.dimensions,
+				metricValue:      (float64(s.satisfied) + float64(s.tolerating)/2) / float64(s.total),
+				metricTimeStamp:  now.UnixMilli(),
+				metricType:       metrics.Gauge,
+			})
+		}
+		if s.checked > 0 && sendAvailability {
+			sliMetrics = append(sliMetrics, dynatraceMetric{
+				metricKeyPrefix:  o.config.MetricPrefix.String,
+				metricKeyName:    availabilityMetric,
+				metricDimensions: s.dimensions,
+				metricValue:      100 * float64(s.checked-s.failed) / float64(s.checked),
+				metricTimeStamp:  now.UnixMilli(),
+				metricType:       metrics.Gauge,
+			})
+		}
+	}
+	return sliMetrics
+}
@@ -0,0 +1,91 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseApdexThresholds(t *testing.T) {
+	t.Parallel()
+
+	thresholds, err := parseApdexThresholds("300ms, 1.2s")
+	require.NoError(t, err)
+	assert.Equal(t, apdexThresholds{satisfied: 300 * time.Millisecond, tolerating: 1200 * time.Millisecond}, thresholds)
+
+	_, err = parseApdexThresholds("300ms")
+	assert.ErrorContains(t, err, "expected <satisfied>,<tolerating>")
+	_, err = parseApdexThresholds("2s,1s")
+	assert.ErrorContains(t, err, "not greater than the tolerating one")
+}
+
+func TestApdexMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	failed := registry.MustNewMetric("http_req_failed", metrics.Rate)
+	request := func(name string, ms float64, ok bool) metrics.Samples {
+		tags := registry.RootTagSet().WithTagsFromMap(map[string]string{
+			"name": name, "scenario": "checkout", "expected_response": map[bool]string{true: "true", false: "false"}[ok],
+			"status": map[bool]string{true: "200", false: "503"}[ok],
+		})
+		failedValue := 0.0
+		if !ok {
+			failedValue = 1
+		}
+		return metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Value: ms},
+			{TimeSeries: metrics.TimeSeries{Metric: failed, Tags: tags}, Value: failedValue},
+		}
+	}
+
+	c := NewConfig()
+	c.Apdex = null.BoolFrom(true)
+	c.ApdexThresholds = map[string]string{"search": "100ms,400ms"}
+	o := &Output{config: &c}
+
+	now := time.Now()
+	sliMetrics := o.apdexMetrics([]metrics.SampleContainer{
+		request("checkout", 200, true),  // satisfied within the global 500ms
+		request("checkout", 1000, true), // tolerating within the global 2s
+		request("search", 200, true),    // tolerating within 400ms of search
+		request("search", 50, false),    // failed, frustrated however fast
+	}, now)
+
+	// the name tag is not kept by default, the thresholds still apply per name,
+	// the outcome tags are no dimensions, so failed and successful requests share the series
+	require.Len(t, sliMetrics, 2)
+	assert.Equal(t, "apdex", sliMetrics[0].metricKeyName)
+	assert.Equal(t, map[string]string{"scenario": "checkout"}, sliMetrics[0].metricDimensions)
+	assert.InDelta(t, (1+0.5+0.5+0)/4.0, sliMetrics[0].metricValue, 0.0001)
+	assert.Equal(t, "sli.availability", sliMetrics[1].metricKeyName)
+	assert.Equal(t, map[string]string{"scenario": "checkout"}, sliMetrics[1].metricDimensions)
+	assert.Equal(t, 75.0, sliMetrics[1].metricValue)
+
+	c.KeepNameTag = null.BoolFrom(true)
+	sliMetrics = o.apdexMetrics([]metrics.SampleContainer{
+		request("checkout", 200, true), request("checkout", 1000, true), request("search", 200, true), request("search", 50, false),
+	}, now)
+	require.Len(t, sliMetrics, 4)
+	assert.Equal(t, map[string]string{"scenario": "checkout", "name": "search"}, sliMetrics[2].metricDimensions)
+	assert.Equal(t, 0.25, sliMetrics[2].metricValue)
+	assert.Equal(t, 50.0, sliMetrics[3].metricValue)
+
+	c.KeepNameTag = null.BoolFrom(false)
+	c.KeepTags = null.BoolFrom(false)
+	sliMetrics = o.apdexMetrics([]metrics.SampleContainer{
+		request("checkout", 200, true), request("checkout", 1000, true), request("search", 200, true), request("search", 50, false),
+	}, now)
+	require.Len(t, sliMetrics, 2)
+	assert.Equal(t, "apdex", sliMetrics[0].metricKeyName)
+	assert.Equal(t, (1+0.5+0.5+0)/4.0, sliMetrics[0].metricValue)
+	assert.Equal(t, "sli.availability", sliMetrics[1].metricKeyName)
+	assert.Equal(t, 75.0, sliMetrics[1].metricValue)
+	assert.Equal(t, now.UnixMilli(), sliMetrics[1].metricTimeStamp)
+	assert.Contains(t, sliMetrics[0].toText(), "k6.apdex ")
+}
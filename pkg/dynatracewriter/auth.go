@@ -0,0 +1,231 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthType selects how requests to Dynatrace are authenticated.
+type AuthType string
+
+const (
+	// AuthTypeNone sends requests without an Authorization header, e.g. to the local OneAgent
+	AuthTypeNone AuthType = "none"
+	// AuthTypeApiToken authenticates with a classic API token, given in plain text or as a file
+	AuthTypeApiToken AuthType = "api-token"
+	// AuthTypeOAuth2 authenticates with an OAuth2 client using the client credentials grant
+	AuthTypeOAuth2 AuthType = "oauth2"
+	// AuthTypeBearer authenticates with a static bearer token, e.g. a platform token
+	AuthTypeBearer AuthType = "bearer"
+)
+
+const (
+	defaultOAuthTokenUrl = "https://sso.dynatrace.com/sso/oauth2/token"
+	// refresh OAuth access tokens this long before they expire to not send requests with a stale token
+	oauthTokenRefreshMargin = 30 * time.Second
+)
+
+// authProvider sets the authentication of requests sent to Dynatrace.
+type authProvider interface {
+	authorize(request *http.Request) error
+}
+
+// ParseAuthType converts the configured value to an AuthType, an empty value means auto-detection.
+func ParseAuthType(s string) (AuthType, error) {
+	switch t := AuthType(strings.ToLower(strings.TrimSpace(s))); t {
+	case "", AuthTypeNone, AuthTypeApiToken, AuthTypeOAuth2, AuthTypeBearer:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown Dynatrace auth type %q, expected one of %s, %s, %s or %s",
+			s, AuthTypeNone, AuthTypeApiToken, AuthTypeOAuth2, AuthTypeBearer)
+	}
+}
+
+// authType returns the configured auth type or the one detected from the credentials.
+func (conf Config) authType() (AuthType, error) {
+	authType, err := ParseAuthType(conf.AuthType.String)
+	if err != nil || len(authType) > 0 {
+		return authType, err
+	}
+	return conf.detectAuthType(), nil
+}
+
+// detectAuthType picks the auth type from the credentials which are configured.
+func (conf Config) detectAuthType() AuthType {
+	switch {
+	case len(conf.ApiToken.String) > 0 || len(conf.ApiTokenFile.String) > 0:
+		return AuthTypeApiToken
+	case len(conf.OAuthClientId.String) > 0:
+		return AuthTypeOAuth2
+	case len(conf.BearerToken.String) > 0:
+		return AuthTypeBearer
+	default:
+		return AuthTypeNone
+	}
+}
+
+// validateAuth checks that the credentials needed by the auth type are present.
+func (conf Config) validateAuth(authType AuthType) error {
+	switch authType {
+	case AuthTypeApiToken:
+		if len(conf.ApiToken.String) > 0 && len(conf.ApiTokenFile.String) > 0 {
+			return fmt.Errorf("The Dynatrace API token and API token file can not be set both")
+		}
+		if len(conf.ApiToken.String) == 0 && len(conf.ApiTokenFile.String) == 0 {
+			return fmt.Errorf("The Dynatrace API token can not been empty or Null")
+		}
+	case AuthTypeOAuth2:
+		if len(conf.OAuthClientId.String) == 0 || len(conf.OAuthClientSecret.String) == 0 {
+			return fmt.Errorf("The Dynatrace OAuth client id and client secret can not been empty or Null")
+		}
+		if _, err := url.Parse(conf.OAuthTokenUrl.String); err != nil {
+			return fmt.Errorf("The Dynatrace OAuth token URL is invalid: %w", err)
+		}
+	case AuthTypeBearer:
+		if len(conf.BearerToken.String) == 0 {
+			return fmt.Errorf("The Dynatrace bearer token can not been empty or Null")
+		}
+	}
+	return nil
+}
+
+// newAuthProvider creates the provider for the auth type of a constructed config, nil when no authentication is used.
+func newAuthProvider(conf *Config, client *http.Client) (authProvider, error) {
+	switch AuthType(conf.AuthType.String) {
+	case AuthTypeApiToken:
+		if len(conf.ApiTokenFile.String) > 0 {
+			tokenFile, err := newApiTokenFile(conf.ApiTokenFile.String)
+			if err != nil {
+				return nil, err
+			}
+			return &apiTokenAuth{tokenFile: tokenFile}, nil
+		}
+		return &apiTokenAuth{token: conf.ApiToken.String}, nil
+	case AuthTypeOAuth2:
+		return newOAuthClientCredentials(conf.OAuthTokenUrl.String, conf.OAuthClientId.String,
+			conf.OAuthClientSecret.String, conf.OAuthScope.String, client), nil
+	case AuthTypeBearer:
+		return &bearerAuth{token: conf.BearerToken.String}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// apiTokenAuth authenticates with a classic Dynatrace API token.
+type apiTokenAuth struct {
+	token     string
+	tokenFile *apiTokenFile
+}
+
+func (a *apiTokenAuth) authorize(request *http.Request) error {
+	token := a.token
+	if a.tokenFile != nil {
+		var err error
+		if token, err = a.tokenFile.Token(); err != nil {
+			return err
+		}
+	}
+	request.Header.Set("Authorization", "Api-Token "+token)
+	return nil
+}
+
+// bearerAuth authenticates with a static bearer token.
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) authorize(request *http.Request) error {
+	request.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// oauthClientCredentials fetches access tokens with the OAuth2 client credentials grant
+// and refreshes them shortly before they expire.
+type oauthClientCredentials struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+	now          func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func newOAuthClientCredentials(tokenUrl, clientId, clientSecret, scope string, client *http.Client) *oauthClientCredentials {
+	return &oauthClientCredentials{
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scope:        scope,
+		client:       client,
+		now:          time.Now,
+	}
+}
+
+func (a *oauthClientCredentials) authorize(request *http.Request) error {
+	token, err := a.token()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// token returns the cached access token or requests a new one if it is about to expire.
+func (a *oauthClientCredentials) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.accessToken) > 0 && a.now().Add(oauthTokenRefreshMargin).Before(a.expiresAt) {
+		return a.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", a.clientId)
+	form.Set("client_secret", a.clientSecret)
+	if len(a.scope) > 0 {
+		form.Set("scope", a.scope)
+	}
+	requestedAt := a.now()
+	response, err := a.client.PostForm(a.tokenUrl, form)
+	if err != nil {
+		return "", fmt.Errorf("Failed to request an OAuth access token: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the OAuth token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("The OAuth token endpoint responded with %s: %s", response.Status, string(body))
+	}
+
+	var tokenResponse oauthTokenResponse
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return "", fmt.Errorf("Failed to parse the OAuth token response: %w", err)
+	}
+	if len(tokenResponse.AccessToken) == 0 {
+		return "", fmt.Errorf("The OAuth token response contains no access token")
+	}
+
+	a.accessToken = tokenResponse.AccessToken
+	a.expiresAt = requestedAt.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+	return a.accessToken, nil
+}
@@ -0,0 +1,81 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestOAuthClientCredentialsRefresh(t *testing.T) {
+	t.Parallel()
+
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "storage:metrics:write", r.PostForm.Get("scope"))
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":300}`, n)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	auth := newOAuthClientCredentials(server.URL, "client", "secret", "storage:metrics:write", server.Client())
+	auth.now = func() time.Time { return now }
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v2/metrics/ingest", nil)
+	require.NoError(t, auth.authorize(request))
+	assert.Equal(t, "Bearer token-1", request.Header.Get("Authorization"))
+
+	// still valid, the cached token is used
+	now = now.Add(4 * time.Minute)
+	require.NoError(t, auth.authorize(request))
+	assert.Equal(t, "Bearer token-1", request.Header.Get("Authorization"))
+
+	// about to expire, a new token is requested
+	now = now.Add(45 * time.Second)
+	require.NoError(t, auth.authorize(request))
+	assert.Equal(t, "Bearer token-2", request.Header.Get("Authorization"))
+
+	wrongSecret := newOAuthClientCredentials(server.URL, "client", "wrong", "", server.Client())
+	assert.ErrorContains(t, wrongSecret.authorize(request), "401")
+}
+
+func TestConstructConfigAuthTypes(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.Url = null.StringFrom("https://abc123.live.dynatrace.com")
+	c.BearerToken = null.StringFrom("platform-token")
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("bearer"), constructed.AuthType)
+	auth, err := newAuthProvider(constructed, nil)
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, constructed.Url.String, nil)
+	require.NoError(t, auth.authorize(request))
+	assert.Equal(t, "Bearer platform-token", request.Header.Get("Authorization"))
+
+	c = NewConfig()
+	c.Url = null.StringFrom("https://abc123.live.dynatrace.com")
+	c.OAuthClientId = null.StringFrom("client")
+	_, err = c.ConstructConfig()
+	assert.ErrorContains(t, err, "client secret")
+
+	c = NewConfig()
+	c.Url = null.StringFrom("https://abc123.live.dynatrace.com")
+	c.AuthType = null.StringFrom("kerberos")
+	_, err = c.ConstructConfig()
+	assert.ErrorContains(t, err, "unknown Dynatrace auth type")
+}
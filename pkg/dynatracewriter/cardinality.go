@@ -0,0 +1,122 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otherDimensionValue replaces the tag values of the series above the limit of a metric.
+const otherDimensionValue = "__other__"
+
+// metricCardinality tracks the series of one metric key.
+type metricCardinality struct {
+	series map[string]struct{}
+	// values are the tag values of the admitted series, to tell which tag keys bring new values
+	values    map[string]map[string]struct{}
+	folded    int
+	offenders map[string]int
+}
+
+// cardinalityLimiter caps the number of distinct dimension sets per metric key. Series above the cap are
+// folded into one series per metric with all tag values replaced by __other__, the configured dimensions are kept.
+type cardinalityLimiter struct {
+	metrics  map[string]*metricCardinality
+	reported bool
+}
+
+// limit returns the dimensions to send for a sample of the metric, either unchanged or folded.
+func (l *cardinalityLimiter) limit(max int, name string, dimensions map[string]string, static map[string]string) map[string]string {
+	if max <= 0 {
+		return dimensions
+	}
+	if l.metrics == nil {
+		l.metrics = make(map[string]*metricCardinality)
+	}
+	m, ok := l.metrics[name]
+	if !ok {
+		m = &metricCardinality{
+			series:    make(map[string]struct{}),
+			values:    make(map[string]map[string]struct{}),
+			offenders: make(map[string]int),
+		}
+		l.metrics[name] = m
+	}
+
+	key := seriesKey(name, dimensions)
+	if _, ok := m.series[key]; ok {
+		return dimensions
+	}
+	if len(m.series) < max {
+		m.series[key] = struct{}{}
+		for k, v := range dimensions {
+			if m.values[k] == nil {
+				m.values[k] = make(map[string]struct{})
+			}
+			m.values[k][v] = struct{}{}
+		}
+		return dimensions
+	}
+
+	m.folded++
+	folded := make(map[string]string, len(dimensions))
+	for k, v := range dimensions {
+		if staticValue, ok := static[k]; ok && staticValue == v {
+			folded[k] = v
+			continue
+		}
+		if _, seen := m.values[k][v]; !seen {
+			m.offenders[k]++
+		}
+		folded[k] = otherDimensionValue
+	}
+	return folded
+}
+
+// report logs the metrics which exceeded the limit and the tag keys which brought the most new values, once per run.
+func (l *cardinalityLimiter) report(logger logrus.FieldLogger, max int) {
+	if l.reported {
+		return
+	}
+	var (
+		names     []string
+		offenders = make(map[string]int)
+	)
+	for name, m := range l.metrics {
+		if m.folded == 0 {
+			continue
+		}
+		names = append(names, fmt.Sprintf("%s (%d samples)", name, m.folded))
+		for k, n := range m.offenders {
+			offenders[k] += n
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	l.reported = true
+
+	keys := make([]string, 0, len(offenders))
+	for k := range offenders {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if offenders[keys[i]] != offenders[keys[j]] {
+			return offenders[keys[i]] > offenders[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > 3 {
+		keys = keys[:3]
+	}
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s (%d)", k, offenders[k])
+	}
+	sort.Strings(names)
+
+	logger.WithField("metrics", strings.Join(names, ", ")).
+		WithField("tagKeys", strings.Join(keys, ", ")).
+		Warn(fmt.Sprintf("Dynatrace: metrics exceeded %d series, the excess was sent with the dimension value %s", max, otherDimensionValue))
+}
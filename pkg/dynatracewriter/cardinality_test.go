@@ -0,0 +1,71 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCardinalityLimiter(t *testing.T) {
+	t.Parallel()
+
+	static := map[string]string{"env": "staging"}
+	var l cardinalityLimiter
+	for i := 0; i < 5; i++ {
+		dims := map[string]string{"env": "staging", "method": "GET", "url": fmt.Sprintf("https://example.com/users/%d", i)}
+		limited := l.limit(3, "http_req_duration", dims, static)
+		if i < 3 {
+			assert.Equal(t, dims, limited)
+		} else {
+			assert.Equal(t, map[string]string{"env": "staging", "method": otherDimensionValue, "url": otherDimensionValue}, limited)
+		}
+	}
+
+	// known series are kept, other metrics have their own limit
+	known := map[string]string{"env": "staging", "method": "GET", "url": "https://example.com/users/1"}
+	assert.Equal(t, known, l.limit(3, "http_req_duration", known, static))
+	assert.Equal(t, known, l.limit(3, "http_req_waiting", known, static))
+	// 0 turns the limit off
+	assert.Equal(t, map[string]string{"url": "x"}, l.limit(0, "http_req_duration", map[string]string{"url": "x"}, static))
+
+	logger, hook := logtest.NewNullLogger()
+	l.report(logger, 3)
+	l.report(logger, 3)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, "http_req_duration (2 samples)", hook.LastEntry().Data["metrics"])
+	assert.Equal(t, "url (2)", hook.LastEntry().Data["tagKeys"])
+}
+
+func TestCardinalityLimiterSliMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	failed := registry.MustNewMetric("http_req_failed", metrics.Rate)
+	var requests []metrics.SampleContainer
+	for i := 0; i < 5; i++ {
+		tags := registry.RootTagSet().WithTagsFromMap(map[string]string{"url": fmt.Sprintf("https://example.com/users/%d", i)})
+		requests = append(requests, metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Value: 100},
+			{TimeSeries: metrics.TimeSeries{Metric: failed, Tags: tags}, Value: 0},
+		})
+	}
+
+	c := NewConfig()
+	c.Apdex = null.BoolFrom(true)
+	c.KeepUrlTag = null.BoolFrom(true)
+	c.MaxSeriesPerMetric = null.IntFrom(2)
+	o := &Output{config: &c}
+
+	sliMetrics := o.apdexMetrics(requests, time.Now())
+	// two series of their own and the folded one, sorted first, each with the Apdex and the availability
+	require.Len(t, sliMetrics, 6)
+	assert.Equal(t, map[string]string{"url": otherDimensionValue}, sliMetrics[0].metricDimensions)
+	assert.Equal(t, map[string]string{"url": otherDimensionValue}, sliMetrics[1].metricDimensions)
+}
@@ -0,0 +1,89 @@
+package dynatracewriter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultRetryBackoff is the wait before the first retry, it doubles with every further retry.
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// newHTTPClient returns the client of all the requests to Dynatrace, including the ones for OAuth tokens.
+// The certificates of the CA file are trusted in addition to the ones of the system.
+func newHTTPClient(conf *Config) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.InsecureSkipTLSVerify.Bool} //nolint:gosec // opted in by the user
+	if len(conf.CACert.String) > 0 {
+		pem, err := os.ReadFile(conf.CACert.String)
+		if err != nil {
+			return nil, fmt.Errorf("The CA certificate file can not be read: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("The CA certificate file %s holds no PEM certificate", conf.CACert.String)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: defaultDynatraceTimeout, Transport: transport}, nil
+}
+
+// apiResponse is the part of a Dynatrace API response the output looks at.
+type apiResponse struct {
+	status     string
+	statusCode int
+	body       []byte
+}
+
+// post sends the body to a Dynatrace API. Network errors, failures to obtain the credentials, 429 and 5xx responses
+// are retried up to the configured number of retries.
+// All the APIs share the client, the headers, the authentication and the retries of the metrics ingest.
+func (o *Output) post(url string, contentType string, body []byte) (apiResponse, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := o.postOnce(url, contentType, body)
+		if attempt >= int(o.config.Retries.Int64) || !isRetryable(response, err) {
+			return response, err
+		}
+		wait := o.retryBackoff << attempt
+		if err != nil {
+			o.logger.WithError(err).Debug("Dynatrace: retrying the request in " + wait.String())
+		} else {
+			o.logger.Debug("Dynatrace: retrying the request after " + response.status + " in " + wait.String())
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (o *Output) postOnce(url string, contentType string, body []byte) (apiResponse, error) {
+	request, err := o.newRequest(url, contentType, body)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	o.logger.Debug("request Headers:" + headersToLog(request.Header))
+	response, err := o.client.Do(request)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	defer response.Body.Close()
+	o.logger.Debug("response Status:" + response.Status)
+	o.logger.Debug("response Headers:" + headersToLog(response.Header))
+	responseBody, _ := io.ReadAll(response.Body)
+	o.logger.Debug("response Body:" + string(responseBody))
+	return apiResponse{status: response.Status, statusCode: response.StatusCode, body: responseBody}, nil
+}
+
+// isRetryable reports whether a request may succeed when it is sent again.
+func isRetryable(response apiResponse, err error) bool {
+	if err != nil {
+		return true
+	}
+	return response.statusCode == http.StatusTooManyRequests || response.statusCode >= 500
+}
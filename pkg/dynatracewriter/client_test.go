@@ -0,0 +1,110 @@
+package dynatracewriter
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestPostRetries(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		statuses []int
+		retries  int64
+		requests int
+		status   int
+	}{
+		"accepted":           {statuses: []int{202}, retries: 2, requests: 1, status: 202},
+		"unavailable_once":   {statuses: []int{503, 202}, retries: 2, requests: 2, status: 202},
+		"throttled":          {statuses: []int{429, 429, 202}, retries: 2, requests: 3, status: 202},
+		"retries_exhausted":  {statuses: []int{502, 503, 504}, retries: 2, requests: 3, status: 504},
+		"retries_disabled":   {statuses: []int{503}, retries: 0, requests: 1, status: 503},
+		"client_error":       {statuses: []int{400}, retries: 2, requests: 1, status: 400},
+		"invalid_credential": {statuses: []int{401}, retries: 2, requests: 1, status: 401},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			requests := 0
+			o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "payload", string(body), "every attempt sends the whole body")
+				assert.Equal(t, "Api-Token token", r.Header.Get("Authorization"))
+				w.WriteHeader(testCase.statuses[requests])
+				requests++
+			}, func(c *Config) {
+				c.Retries = null.IntFrom(testCase.retries)
+			})
+
+			response, err := o.post(o.config.Url.String, "", []byte("payload"))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.status, response.statusCode)
+			assert.Equal(t, testCase.requests, requests)
+		})
+	}
+}
+
+func TestHTTPClientTLS(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	testCases := map[string]struct {
+		insecure  bool
+		caFile    string
+		errString string
+	}{
+		"verified":       {errString: "certificate"},
+		"trusted CA":     {caFile: caFile},
+		"insecure":       {insecure: true},
+		"missing CA":     {caFile: filepath.Join(t.TempDir(), "missing.pem"), errString: "can not be read"},
+		"CA without PEM": {caFile: "client_test.go", errString: "holds no PEM certificate"},
+	}
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewConfig()
+			c.InsecureSkipTLSVerify = null.BoolFrom(testCase.insecure)
+			c.CACert = null.StringFrom(testCase.caFile)
+			client, err := newHTTPClient(&c)
+			if err == nil {
+				var response *http.Response
+				if response, err = client.Get(server.URL); err == nil {
+					response.Body.Close()
+				}
+			}
+			if len(testCase.errString) > 0 {
+				assert.ErrorContains(t, err, testCase.errString)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	c := NewConfig()
+	c.OAuthTokenUrl = null.StringFrom(server.URL)
+	c.AuthType = null.StringFrom(string(AuthTypeOAuth2))
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	auth, err := newAuthProvider(&c, client)
+	require.NoError(t, err)
+	assert.Same(t, client, auth.(*oauthClientCredentials).client, "the tokens are fetched with the same TLS settings")
+}
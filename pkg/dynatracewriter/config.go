@@ -2,114 +2,206 @@ package dynatracewriter
 
 import (
 	"encoding/json"
-	"net/url"
-	"strconv"
-	"strings"
+	"fmt"
 	"time"
-    "fmt"
+
 	"github.com/kubernetes/helm/pkg/strvals"
 	"go.k6.io/k6/lib/types"
-    "gopkg.in/guregu/null.v3"
+	"gopkg.in/guregu/null.v3"
 )
 
 const (
-	defaultDynatraceTimeout = time.Minute
-	defaultFlushPeriod       = time.Second
-	defaultMetricPrefix      = "k6."
-	defaultDynatraceMetricEndPoint ="/api/v2/metrics/ingest"
+	defaultDynatraceTimeout        = time.Minute
+	defaultFlushPeriod             = time.Second
+	defaultMetricPrefix            = metricKeyPrefix
+	defaultDynatraceMetricEndPoint = "/api/v2/metrics/ingest"
+	// scriptOptionsKey is the key of the output options in the options.ext block of the test script
+	scriptOptionsKey = "dynatrace"
 )
 
 type Config struct {
-	Url string `json:"url" envconfig:"K6_DYNATRACE_URL"` // here, in the name of env variable, we assume that we won't need to distinguish between remote write URL vs remote read URL
-    Headers map[string]string `json:"headers" envconfig:"K6_DYNATRACE_HEADER"`
-	InsecureSkipTLSVerify null.Bool   `json:"insecureSkipTLSVerify" envconfig:"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY"`
-	CACert                null.String `json:"caCertFile" envconfig:"K6_CA_CERT_FILE"`
-	ApiToken     null.String `json:"apitoken" envconfig:"K6_DYNATRACE_APITOKEN"`
-	FlushPeriod types.NullDuration `json:"flushPeriod" envconfig:"K6_DYNATRACE_FLUSH_PERIOD"`
-	KeepTags    null.Bool `json:"keepTags" envconfig:"K6_KEEP_TAGS"`
-	KeepNameTag null.Bool `json:"keepNameTag" envconfig:"K6_KEEP_NAME_TAG"`
-	KeepUrlTag  null.Bool `json:"keepUrlTag" envconfig:"K6_KEEP_URL_TAG"`
+	Url                      null.String        `json:"url"`
+	Headers                  map[string]string  `json:"headers"`
+	InsecureSkipTLSVerify    null.Bool          `json:"insecureSkipTLSVerify"`
+	CACert                   null.String        `json:"caCertFile"`
+	ApiToken                 null.String        `json:"apitoken"`
+	ApiTokenFile             null.String        `json:"apiTokenFile"`
+	FlushPeriod              types.NullDuration `json:"flushPeriod"`
+	KeepTags                 null.Bool          `json:"keepTags"`
+	KeepNameTag              null.Bool          `json:"keepNameTag"`
+	KeepUrlTag               null.Bool          `json:"keepUrlTag"`
+	EndpointMode             null.String        `json:"endpointMode"`
+	AuthType                 null.String        `json:"authType"`
+	OAuthTokenUrl            null.String        `json:"oauthTokenUrl"`
+	OAuthClientId            null.String        `json:"oauthClientId"`
+	OAuthClientSecret        null.String        `json:"oauthClientSecret"`
+	OAuthScope               null.String        `json:"oauthScope"`
+	BearerToken              null.String        `json:"bearerToken"`
+	Preflight                null.Bool          `json:"preflight"`
+	MetricPrefix             null.String        `json:"metricPrefix"`
+	Dimensions               map[string]string  `json:"dimensions"`
+	TestRunId                null.String        `json:"testRunId"`
+	Events                   null.Bool          `json:"events"`
+	EventType                null.String        `json:"eventType"`
+	EventEntitySelector      null.String        `json:"eventEntitySelector"`
+	ThresholdResults         null.Bool          `json:"thresholdResults"`
+	LiveThresholds           null.Bool          `json:"liveThresholds"`
+	MaxFailedFlushes         null.Int           `json:"maxFailedFlushes"`
+	Retries                  null.Int           `json:"retries"`
+	Logs                     null.Bool          `json:"logs"`
+	LogLevel                 null.String        `json:"logLevel"`
+	FailedRequests           null.Bool          `json:"failedRequests"`
+	FailedRequestsSampleRate null.Float         `json:"failedRequestsSampleRate"`
+	FailedRequestsPerFlush   null.Int           `json:"failedRequestsPerFlush"`
+	SummaryEvent             null.Bool          `json:"summaryEvent"`
+	Protocol                 null.String        `json:"protocol"`
+	Traces                   null.Bool          `json:"traces"`
+	TrendPercentiles         null.Bool          `json:"trendPercentiles"`
+	Percentiles              null.String        `json:"percentiles"`
+	PercentileFormat         null.String        `json:"percentileFormat"`
+	HistogramBuckets         map[string]string  `json:"histogramBuckets"`
+	HistogramCounts          null.String        `json:"histogramCounts"`
+	Apdex                    null.Bool          `json:"apdex"`
+	ApdexSatisfied           types.NullDuration `json:"apdexSatisfied"`
+	ApdexTolerating          types.NullDuration `json:"apdexTolerating"`
+	ApdexThresholds          map[string]string  `json:"apdexThresholds"`
+	AggregationWindow        types.NullDuration `json:"aggregationWindow"`
+	MaxSeriesPerMetric       null.Int           `json:"maxSeriesPerMetric"`
+	IncludeMetrics           null.String        `json:"includeMetrics"`
+	ExcludeMetrics           null.String        `json:"excludeMetrics"`
+	MetricTypes              null.String        `json:"metricTypes"`
+
+	// warnings found while consolidating the config, e.g. deprecated environment variables
+	warnings []string
+}
+
+// configFields declares every option of the output once: its JSON and argument key, its environment
+// variable and its default. Defaults, the JSON config, the config file profile, the script options, the environment
+// and the -o argument are all parsed from this table, with the precedence
+// default < JSON < profile < script options < environment < argument.
+var configFields = []configField{
+	{key: "url", env: "K6_DYNATRACE_URL", field: func(c *Config) interface{} { return &c.Url }},
+	{key: "headers", env: "K6_DYNATRACE_HEADER_", deprecatedEnv: []string{"K6_DYNATRACE_HEADER"}, envKey: headerNameFromEnv, field: func(c *Config) interface{} { return &c.Headers }},
+	{key: "insecureSkipTLSVerify", env: "K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY", def: "true", field: func(c *Config) interface{} { return &c.InsecureSkipTLSVerify }},
+	{key: "caCertFile", env: "K6_DYNATRACE_CA_CERT_FILE", deprecatedEnv: []string{"K6_CA_CERT_FILE"}, isPath: true, field: func(c *Config) interface{} { return &c.CACert }},
+	{key: "apitoken", env: "K6_DYNATRACE_APITOKEN", field: func(c *Config) interface{} { return &c.ApiToken }},
+	{key: "apiTokenFile", env: "K6_DYNATRACE_APITOKEN_FILE", isPath: true, field: func(c *Config) interface{} { return &c.ApiTokenFile }},
+	{key: "flushPeriod", env: "K6_DYNATRACE_FLUSH_PERIOD", def: defaultFlushPeriod.String(), field: func(c *Config) interface{} { return &c.FlushPeriod }},
+	{key: "keepTags", env: "K6_DYNATRACE_KEEP_TAGS", deprecatedEnv: []string{"K6_KEEP_TAGS"}, def: "true", field: func(c *Config) interface{} { return &c.KeepTags }},
+	{key: "keepNameTag", env: "K6_DYNATRACE_KEEP_NAME_TAG", deprecatedEnv: []string{"K6_KEEP_NAME_TAG"}, def: "false", field: func(c *Config) interface{} { return &c.KeepNameTag }},
+	{key: "keepUrlTag", env: "K6_DYNATRACE_KEEP_URL_TAG", deprecatedEnv: []string{"K6_KEEP_URL_TAG"}, def: "true", field: func(c *Config) interface{} { return &c.KeepUrlTag }},
+	{key: "endpointMode", env: "K6_DYNATRACE_ENDPOINT_MODE", field: func(c *Config) interface{} { return &c.EndpointMode }},
+	{key: "authType", env: "K6_DYNATRACE_AUTH_TYPE", field: func(c *Config) interface{} { return &c.AuthType }},
+	{key: "oauthTokenUrl", env: "K6_DYNATRACE_OAUTH_TOKEN_URL", def: defaultOAuthTokenUrl, field: func(c *Config) interface{} { return &c.OAuthTokenUrl }},
+	{key: "oauthClientId", env: "K6_DYNATRACE_OAUTH_CLIENT_ID", field: func(c *Config) interface{} { return &c.OAuthClientId }},
+	{key: "oauthClientSecret", env: "K6_DYNATRACE_OAUTH_CLIENT_SECRET", field: func(c *Config) interface{} { return &c.OAuthClientSecret }},
+	{key: "oauthScope", env: "K6_DYNATRACE_OAUTH_SCOPE", field: func(c *Config) interface{} { return &c.OAuthScope }},
+	{key: "bearerToken", env: "K6_DYNATRACE_BEARER_TOKEN", field: func(c *Config) interface{} { return &c.BearerToken }},
+	{key: "preflight", env: "K6_DYNATRACE_PREFLIGHT", def: "false", field: func(c *Config) interface{} { return &c.Preflight }},
+	{key: "metricPrefix", env: "K6_DYNATRACE_METRIC_PREFIX", def: defaultMetricPrefix, field: func(c *Config) interface{} { return &c.MetricPrefix }},
+	{key: "dimensions", env: "K6_DYNATRACE_DIMENSION_", field: func(c *Config) interface{} { return &c.Dimensions }},
+	{key: "testRunId", env: "K6_DYNATRACE_TEST_RUN_ID", field: func(c *Config) interface{} { return &c.TestRunId }},
+	{key: "events", env: "K6_DYNATRACE_EVENTS", def: "false", field: func(c *Config) interface{} { return &c.Events }},
+	{key: "eventType", env: "K6_DYNATRACE_EVENT_TYPE", def: defaultEventType, field: func(c *Config) interface{} { return &c.EventType }},
+	{key: "eventEntitySelector", env: "K6_DYNATRACE_EVENT_ENTITY_SELECTOR", field: func(c *Config) interface{} { return &c.EventEntitySelector }},
+	{key: "thresholdResults", env: "K6_DYNATRACE_THRESHOLD_RESULTS", def: "true", field: func(c *Config) interface{} { return &c.ThresholdResults }},
+	{key: "liveThresholds", env: "K6_DYNATRACE_LIVE_THRESHOLDS", def: "false", field: func(c *Config) interface{} { return &c.LiveThresholds }},
+	{key: "maxFailedFlushes", env: "K6_DYNATRACE_MAX_FAILED_FLUSHES", def: "10", field: func(c *Config) interface{} { return &c.MaxFailedFlushes }},
+	{key: "retries", env: "K6_DYNATRACE_RETRIES", def: "2", field: func(c *Config) interface{} { return &c.Retries }},
+	{key: "logs", env: "K6_DYNATRACE_LOGS", def: "false", field: func(c *Config) interface{} { return &c.Logs }},
+	{key: "logLevel", env: "K6_DYNATRACE_LOG_LEVEL", def: defaultLogLevel, field: func(c *Config) interface{} { return &c.LogLevel }},
+	{key: "failedRequests", env: "K6_DYNATRACE_FAILED_REQUESTS", def: "false", field: func(c *Config) interface{} { return &c.FailedRequests }},
+	{key: "failedRequestsSampleRate", env: "K6_DYNATRACE_FAILED_REQUESTS_SAMPLE_RATE", def: "1", field: func(c *Config) interface{} { return &c.FailedRequestsSampleRate }},
+	{key: "failedRequestsPerFlush", env: "K6_DYNATRACE_FAILED_REQUESTS_PER_FLUSH", def: "100", field: func(c *Config) interface{} { return &c.FailedRequestsPerFlush }},
+	{key: "summaryEvent", env: "K6_DYNATRACE_SUMMARY_EVENT", def: "false", field: func(c *Config) interface{} { return &c.SummaryEvent }},
+	{key: "protocol", env: "K6_DYNATRACE_PROTOCOL", def: string(ProtocolLine), field: func(c *Config) interface{} { return &c.Protocol }},
+	{key: "traces", env: "K6_DYNATRACE_TRACES", def: "false", field: func(c *Config) interface{} { return &c.Traces }},
+	{key: "trendPercentiles", env: "K6_DYNATRACE_TREND_PERCENTILES", def: "false", field: func(c *Config) interface{} { return &c.TrendPercentiles }},
+	{key: "percentiles", env: "K6_DYNATRACE_PERCENTILES", def: defaultPercentiles, field: func(c *Config) interface{} { return &c.Percentiles }},
+	{key: "percentileFormat", env: "K6_DYNATRACE_PERCENTILE_FORMAT", def: string(PercentileFormatKey), field: func(c *Config) interface{} { return &c.PercentileFormat }},
+	{key: "histogramBuckets", env: "K6_DYNATRACE_HISTOGRAM_BUCKETS_", envKey: metricNameFromEnv, field: func(c *Config) interface{} { return &c.HistogramBuckets }},
+	{key: "histogramCounts", env: "K6_DYNATRACE_HISTOGRAM_COUNTS", def: string(HistogramCountsCumulative), field: func(c *Config) interface{} { return &c.HistogramCounts }},
+	{key: "apdex", env: "K6_DYNATRACE_APDEX", def: "false", field: func(c *Config) interface{} { return &c.Apdex }},
+	{key: "apdexSatisfied", env: "K6_DYNATRACE_APDEX_SATISFIED", def: "500ms", field: func(c *Config) interface{} { return &c.ApdexSatisfied }},
+	{key: "apdexTolerating", env: "K6_DYNATRACE_APDEX_TOLERATING", def: "2s", field: func(c *Config) interface{} { return &c.ApdexTolerating }},
+	{key: "apdexThresholds", env: "K6_DYNATRACE_APDEX_THRESHOLDS_", field: func(c *Config) interface{} { return &c.ApdexThresholds }},
+	{key: "aggregationWindow", env: "K6_DYNATRACE_AGGREGATION_WINDOW", def: "0s", field: func(c *Config) interface{} { return &c.AggregationWindow }},
+	{key: "maxSeriesPerMetric", env: "K6_DYNATRACE_MAX_SERIES_PER_METRIC", def: "1000", field: func(c *Config) interface{} { return &c.MaxSeriesPerMetric }},
+	{key: "includeMetrics", env: "K6_DYNATRACE_INCLUDE_METRICS", field: func(c *Config) interface{} { return &c.IncludeMetrics }},
+	{key: "excludeMetrics", env: "K6_DYNATRACE_EXCLUDE_METRICS", field: func(c *Config) interface{} { return &c.ExcludeMetrics }},
+	{key: "metricTypes", env: "K6_DYNATRACE_METRIC_TYPES", field: func(c *Config) interface{} { return &c.MetricTypes }},
 }
 
+// NewConfig returns a config with the defaults of all options.
 func NewConfig() Config {
-	return Config{
-		Url:                   "https://dynatrace.live.com",
-		InsecureSkipTLSVerify: null.BoolFrom(true),
-		CACert:                null.NewString("", false),
-        ApiToken:              null.NewString("", false),
-		FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
-		KeepTags:              null.BoolFrom(true),
-		KeepNameTag:           null.BoolFrom(false),
-		KeepUrlTag:            null.BoolFrom(true),
-		Headers:               make(map[string]string),
+	c := Config{}
+	for _, f := range configFields {
+		f.setDefault(&c)
 	}
+	return c
 }
 
 func (conf Config) ConstructConfig() (*Config, error) {
 	// TODO: consider if the auth logic should be enforced here
 	// (e.g. if insecureSkipTLSVerify is switched off, then check for non-empty certificate file and auth, etc.)
 
-	u, err := url.Parse(conf.Url+defaultDynatraceMetricEndPoint)
-	if err != nil {
+	if err := conf.Validate(); err != nil {
 		return nil, err
 	}
-    if len(conf.ApiToken.String) == 0 {
-       return nil, fmt.Errorf("The Dynatrace API token can not been empty or Null")
-    } else {
-        conf.Headers["Content-Type"] = "text/plain; charset=utf-8"
-        conf.Headers["Authorization"] ="Api-Token " + conf.ApiToken.String
-        conf.Headers["accept"] = "*/*"
-    }
-     conf.Url= u.String()
-
-	return &conf, nil
-}
-
-// From here till the end of the file partial duplicates waiting for config refactor (k6 #883)
-
-func (base Config) Apply(applied Config) Config {
-
-
-	if len(applied.Url)>0 {
-		base.Url = applied.Url
-	}
 
-	if applied.InsecureSkipTLSVerify.Valid {
-		base.InsecureSkipTLSVerify = applied.InsecureSkipTLSVerify
+	mode, _ := conf.endpointMode()
+	conf.EndpointMode = null.StringFrom(string(mode))
+	protocol, _ := ParseProtocol(conf.Protocol.String)
+	conf.Protocol = null.StringFrom(string(protocol))
+	u, err := mode.ingestUrl(conf.Url.String, protocol)
+	if err != nil {
+		return nil, err
 	}
 
-	if applied.CACert.Valid {
-		base.CACert = applied.CACert
-	}
+	authType, _ := conf.authType()
+	conf.AuthType = null.StringFrom(string(authType))
 
-	if applied.ApiToken.Valid {
-		base.ApiToken = applied.ApiToken
+	// the Authorization header is set per request by the auth provider
+	headers := make(map[string]string, len(conf.Headers)+2)
+	for k, v := range conf.Headers {
+		headers[k] = v
 	}
+	conf.Headers = headers
+	conf.Headers["Content-Type"] = protocol.contentType()
+	conf.Headers["accept"] = "*/*"
+	conf.Url = null.StringFrom(u.String())
 
+	return &conf, nil
+}
 
-
-	if applied.FlushPeriod.Valid {
-		base.FlushPeriod = applied.FlushPeriod
-	}
-
-	if applied.KeepTags.Valid {
-		base.KeepTags = applied.KeepTags
+// String returns a printable representation of the config with the API token and sensitive headers redacted.
+func (conf Config) String() string {
+	redacted := conf
+	for _, secret := range []*null.String{&redacted.ApiToken, &redacted.OAuthClientSecret, &redacted.BearerToken} {
+		if len(secret.String) > 0 {
+			*secret = null.StringFrom(redactToken(secret.String))
+		}
 	}
-
-	if applied.KeepNameTag.Valid {
-		base.KeepNameTag = applied.KeepNameTag
+	redacted.Headers = make(map[string]string, len(conf.Headers))
+	for k, v := range conf.Headers {
+		if isSensitiveHeader(k) {
+			v = redactToken(v)
+		}
+		redacted.Headers[k] = v
 	}
-
-	if applied.KeepUrlTag.Valid {
-		base.KeepUrlTag = applied.KeepUrlTag
+	b, err := json.Marshal(redacted)
+	if err != nil {
+		return err.Error()
 	}
+	return string(b)
+}
 
-	if len(applied.Headers) > 0 {
-		for k, v := range applied.Headers {
-			base.Headers[k] = v
-		}
+// Apply overrides the options of base with all the options set in applied.
+// Maps are merged into a copy, so base and applied are never modified.
+func (base Config) Apply(applied Config) Config {
+	for _, f := range configFields {
+		f.apply(&base, &applied)
 	}
-
 	return base
 }
 
@@ -120,156 +212,87 @@ func ParseArg(arg string) (Config, error) {
 	if err != nil {
 		return c, err
 	}
-
-	if v, ok := params["url"].(string); ok {
-		c.Url = v
-	}
-
-	if v, ok := params["insecureSkipTLSVerify"].(bool); ok {
-		c.InsecureSkipTLSVerify = null.BoolFrom(v)
-	}
-
-	if v, ok := params["caCertFile"].(string); ok {
-		c.CACert = null.StringFrom(v)
-	}
-
-	if v, ok := params["apitoken"].(string); ok {
-		c.ApiToken = null.StringFrom(v)
-	}
-
-
-	if v, ok := params["flushPeriod"].(string); ok {
-		if err := c.FlushPeriod.UnmarshalText([]byte(v)); err != nil {
-			return c, err
-		}
-	}
-
-	if v, ok := params["keepTags"].(bool); ok {
-		c.KeepTags = null.BoolFrom(v)
-	}
-
-	if v, ok := params["keepNameTag"].(bool); ok {
-		c.KeepNameTag = null.BoolFrom(v)
-	}
-
-	if v, ok := params["keepUrlTag"].(bool); ok {
-		c.KeepUrlTag = null.BoolFrom(v)
-	}
-
-	c.Headers = make(map[string]string)
-	if v, ok := params["headers"].(map[string]interface{}); ok {
-		for k, v := range v {
-			if v, ok := v.(string); ok {
-				c.Headers[k] = v
+	for _, f := range configFields {
+		if v, ok := params[f.key]; ok {
+			if err := f.parseArg(&c, v); err != nil {
+				return c, err
 			}
 		}
 	}
-
 	return c, nil
 }
 
-// GetConsolidatedConfig combines {default config values + JSON config +
-// environment vars + arg config values}, and returns the final result.
-func GetConsolidatedConfig(jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
-	result := NewConfig()
-	if jsonRawConf != nil {
-		jsonConf := Config{}
-		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
-			return result, err
-		}
-		result = result.Apply(jsonConf)
+// parseJSON takes the JSON config and converts it to a config
+func parseJSON(jsonRawConf json.RawMessage) (Config, error) {
+	var c Config
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(jsonRawConf, &raw); err != nil {
+		return c, err
 	}
-
-	getEnvBool := func(env map[string]string, name string) (null.Bool, error) {
-		if v, vDefined := env[name]; vDefined {
-			if b, err := strconv.ParseBool(v); err != nil {
-				return null.NewBool(false, false), err
-			} else {
-				return null.BoolFrom(b), nil
+	for _, f := range configFields {
+		if v, ok := raw[f.key]; ok {
+			if err := f.parseJSON(&c, v); err != nil {
+				return c, err
 			}
 		}
-		return null.NewBool(false, false), nil
 	}
+	return c, nil
+}
 
-	getEnvMap := func(env map[string]string, prefix string) map[string]string {
-		result := make(map[string]string)
-		for ek, ev := range env {
-			if strings.HasPrefix(ek, prefix) {
-				k := strings.TrimPrefix(ek, prefix)
-				result[k] = ev
-			}
+// parseEnv takes the environment variables and converts them to a config
+func parseEnv(env map[string]string) (Config, error) {
+	var c Config
+	for _, f := range configFields {
+		warnings, err := f.parseEnv(&c, env)
+		if err != nil {
+			return c, err
 		}
-		return result
+		c.warnings = append(c.warnings, warnings...)
 	}
+	return c, nil
+}
 
-	// envconfig is not processing some undefined vars (at least duration) so apply them manually
-	if flushPeriod, flushPeriodDefined := env["K6_DYNATRACE_FLUSH_PERIOD"]; flushPeriodDefined {
-		if err := result.FlushPeriod.UnmarshalText([]byte(flushPeriod)); err != nil {
+// GetConsolidatedConfig combines {default config values + JSON config + config file profile +
+// script options + environment vars + arg config values}, and returns the final result.
+// The script options are the content of the options.ext.dynatrace block of the test script.
+func GetConsolidatedConfig(jsonRawConf json.RawMessage, scriptOptions json.RawMessage, env map[string]string, arg string) (Config, error) {
+	result := NewConfig()
+	if jsonRawConf != nil {
+		jsonConf, err := parseJSON(jsonRawConf)
+		if err != nil {
 			return result, err
 		}
+		result = result.Apply(jsonConf)
 	}
 
-
-
-	if url, urlDefined := env["K6_DYNATRACE_URL"]; urlDefined {
-		result.Url =url
-	}
-
-	if b, err := getEnvBool(env, "K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			// apply only if valid, to keep default option otherwise
-			result.InsecureSkipTLSVerify = b
-		}
-	}
-
-	if ca, caDefined := env["K6_CA_CERT_FILE"]; caDefined {
-		result.CACert = null.StringFrom(ca)
-	}
-
-	if apitoken, userDefined := env["K6_DYNATRACE_APITOKEN"]; userDefined {
-		result.ApiToken = null.StringFrom(apitoken)
-	}
-
-
-	if b, err := getEnvBool(env, "K6_KEEP_TAGS"); err != nil {
+	profileConf, err := parseProfile(env)
+	if err != nil {
 		return result, err
-	} else {
-		if b.Valid {
-			result.KeepTags = b
-		}
 	}
+	result = result.Apply(profileConf)
 
-	if b, err := getEnvBool(env, "K6_KEEP_NAME_TAG"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepNameTag = b
+	if scriptOptions != nil {
+		scriptConf, err := parseJSON(scriptOptions)
+		if err != nil {
+			return result, fmt.Errorf("invalid options.ext.%s in the script: %w", scriptOptionsKey, err)
 		}
+		result = result.Apply(scriptConf)
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_URL_TAG"); err != nil {
+	envConf, err := parseEnv(env)
+	if err != nil {
 		return result, err
-	} else {
-		if b.Valid {
-			result.KeepUrlTag = b
-		}
-	}
-
-	envHeaders := getEnvMap(env, "K6_DYNATRACE_HEADER")
-	for k, v := range envHeaders {
-		result.Headers[k] = v
 	}
+	result = result.Apply(envConf)
+	result.warnings = envConf.warnings
 
 	if arg != "" {
 		argConf, err := ParseArg(arg)
 		if err != nil {
 			return result, err
 		}
-
 		result = result.Apply(argConf)
 	}
 
 	return result, nil
-}
\ No newline at end of file
+}
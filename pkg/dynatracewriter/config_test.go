@@ -4,11 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -19,7 +26,7 @@ func TestApply(t *testing.T) {
 		Url:                   null.StringFrom("some-url"),
 		InsecureSkipTLSVerify: null.BoolFrom(false),
 		CACert:                null.StringFrom("some-file"),
-		ApiToken:                  null.StringFrom("user"),
+		ApiToken:              null.StringFrom("user"),
 		FlushPeriod:           types.NullDurationFrom(10 * time.Second),
 		Headers: map[string]string{
 			"X-Header": "value",
@@ -39,11 +46,18 @@ func TestApply(t *testing.T) {
 	// Defaults shouldn't be impacted by invalid values
 	c = NewConfig()
 	c = c.Apply(Config{
-		ApiToken:                  null.NewString("user", false),
+		ApiToken:              null.NewString("user", false),
 		InsecureSkipTLSVerify: null.NewBool(false, false),
 	})
 	assert.Equal(t, false, c.ApiToken.Valid)
 	assert.Equal(t, true, c.InsecureSkipTLSVerify.Valid)
+
+	// Headers are merged without modifying the base config
+	base := NewConfig()
+	base.Headers["X-Base"] = "base"
+	c = base.Apply(fullConfig)
+	assert.Equal(t, map[string]string{"X-Base": "base", "X-Header": "value"}, c.Headers)
+	assert.Equal(t, map[string]string{"X-Base": "base"}, base.Headers)
 }
 
 func TestConfigParseArg(t *testing.T) {
@@ -51,7 +65,7 @@ func TestConfigParseArg(t *testing.T) {
 
 	c, err := ParseArg("url=https://bix24852.dev.dynatracelabs.com")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com/"), c.Url)
+	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,insecureSkipTLSVerify=false")
 	assert.Nil(t, err)
@@ -68,8 +82,7 @@ func TestConfigParseArg(t *testing.T) {
 	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
 	assert.Equal(t, null.BoolFrom(false), c.InsecureSkipTLSVerify)
 	assert.Equal(t, null.StringFrom("f.crt"), c.CACert)
-	assert.Equal(t, null.StringFrom("apitoken"), c.ApiToken)
-
+	assert.Equal(t, null.StringFrom("dede"), c.ApiToken)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,flushPeriod=2s")
 	assert.Nil(t, err)
@@ -78,41 +91,108 @@ func TestConfigParseArg(t *testing.T) {
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,headers.X-Header=value")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("http://prometheus.remote:3412/write"), c.Url)
+	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
 	assert.Equal(t, map[string]string{"X-Header": "value"}, c.Headers)
+
+	_, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,flushPeriod=d")
+	assert.ErrorContains(t, err, "flushPeriod")
+}
+
+func TestConfigParseArgLists(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		arg      string
+		expected func(c Config) interface{}
+		value    interface{}
+	}{
+		"includeMetrics": {
+			arg:      "includeMetrics={http_req_duration,iterations}",
+			expected: func(c Config) interface{} { return c.IncludeMetrics },
+			value:    null.StringFrom("http_req_duration,iterations"),
+		},
+		"excludeMetrics": {
+			arg:      "excludeMetrics={http_req_tls_handshaking,data_*}",
+			expected: func(c Config) interface{} { return c.ExcludeMetrics },
+			value:    null.StringFrom("http_req_tls_handshaking,data_*"),
+		},
+		"metricTypes": {
+			arg:      "metricTypes={counter,trend}",
+			expected: func(c Config) interface{} { return c.MetricTypes },
+			value:    null.StringFrom("counter,trend"),
+		},
+		"percentiles": {
+			arg:      "percentiles={50,99.9}",
+			expected: func(c Config) interface{} { return c.Percentiles },
+			value:    null.StringFrom("50,99.9"),
+		},
+		"apdexThresholds": {
+			arg:      "apdexThresholds.search={300ms,1.2s}",
+			expected: func(c Config) interface{} { return c.ApdexThresholds },
+			value:    map[string]string{"search": "300ms,1.2s"},
+		},
+		"histogramBuckets": {
+			arg:      "histogramBuckets.http_req_duration={50,100,250}",
+			expected: func(c Config) interface{} { return c.HistogramBuckets },
+			value:    map[string]string{"http_req_duration": "50,100,250"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := ParseArg("url=https://bix24852.dev.dynatracelabs.com,apitoken=dede," + testCase.arg)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.value, testCase.expected(c))
+
+			c = NewConfig().Apply(c)
+			c.TrendPercentiles = null.BoolFrom(true)
+			c.Apdex = null.BoolFrom(true)
+			assert.NoError(t, c.Validate())
+		})
+	}
+
+	c, err := ParseArg("url=https://bix24852.dev.dynatracelabs.com,includeMetrics={http_req_duration,iterations}")
+	require.NoError(t, err)
+	filter, err := newMetricFilter(&c)
+	require.NoError(t, err)
+	registry := metrics.NewRegistry()
+	assert.True(t, filter.allows(registry.MustNewMetric("iterations", metrics.Counter)))
+	assert.False(t, filter.allows(registry.MustNewMetric("vus", metrics.Gauge)))
 }
 
-// testing both GetConsolidatedConfig and ConstructRemoteConfig here until it's future config refactor takes shape (k6 #883)
-func TestConstructRemoteConfig(t *testing.T) {
+// testing both GetConsolidatedConfig and ConstructConfig here
+func TestConstructConfig(t *testing.T) {
 	u, _ := url.Parse("https://bix24852.dev.dynatracelabs.com")
 
 	t.Parallel()
 
 	testCases := map[string]struct {
-		jsonRaw      json.RawMessage
-		env          map[string]string
-		arg          string
-		config       Config
-		errString    string
-		remoteConfig *remote.ClientConfig
+		jsonRaw   json.RawMessage
+		script    json.RawMessage
+		env       map[string]string
+		arg       string
+		config    Config
+		errString string
+		ingestUrl string
 	}{
 		"json_success": {
-			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s","apitoken":"token"}`, u.String())),
 			env:     nil,
 			arg:     "",
 			config: Config{
 				Url:                   null.StringFrom(u.String()),
 				InsecureSkipTLSVerify: null.BoolFrom(true),
-				CACert:                null.NewString("", false),
-				ApiToken:              null.NewString("", false),
+				ApiToken:              null.StringFrom("token"),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
 				KeepUrlTag:            null.BoolFrom(true),
 				Headers:               make(map[string]string),
 			},
-			errString: "",
-
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
 		},
 		"mixed_success": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
@@ -121,42 +201,64 @@ func TestConstructRemoteConfig(t *testing.T) {
 			config: Config{
 				Url:                   null.StringFrom(u.String()),
 				InsecureSkipTLSVerify: null.BoolFrom(false),
-				CACert:                null.NewString("", false),
-                ApiToken:              null.NewString("apitoken", true),
+				ApiToken:              null.StringFrom("user"),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
 				KeepUrlTag:            null.BoolFrom(true),
 				Headers:               make(map[string]string),
 			},
-			errString: "",
-
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
+		},
+		"script_options": {
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s","apitoken":"token","keepTags":false}`, u.String())),
+			script:  json.RawMessage(`{"keepTags":true,"keepUrlTag":false,"flushPeriod":"5s","dimensions":{"test":"checkout"}}`),
+			env:     map[string]string{"K6_DYNATRACE_FLUSH_PERIOD": "2s"},
+			config: Config{
+				Url:                   null.StringFrom(u.String()),
+				InsecureSkipTLSVerify: null.BoolFrom(true),
+				ApiToken:              null.StringFrom("token"),
+				FlushPeriod:           types.NullDurationFrom(2 * time.Second),
+				KeepTags:              null.BoolFrom(true),
+				KeepNameTag:           null.BoolFrom(false),
+				KeepUrlTag:            null.BoolFrom(false),
+				Headers:               make(map[string]string),
+				Dimensions:            map[string]string{"test": "checkout"},
+			},
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
+		},
+		"invalid_script_options": {
+			script:    json.RawMessage(`{"preflight":"maybe"}`),
+			config:    Config{},
+			errString: "options.ext.dynatrace",
 		},
 		"invalid_duration": {
-			jsonRaw:      json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
-			env:          map[string]string{"K6_DYNATRACE_FLUSH_PERIOD": "d"},
-			arg:          "",
-			config:       Config{},
-			errString:    "strconv.ParseInt",
-			remoteConfig: nil,
+			jsonRaw:   json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			env:       map[string]string{"K6_DYNATRACE_FLUSH_PERIOD": "d"},
+			arg:       "",
+			config:    Config{},
+			errString: "strconv.ParseInt",
 		},
 		"invalid_insecureSkipTLSVerify": {
-			jsonRaw:      json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
-			env:          map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "d"},
-			arg:          "",
-			config:       Config{},
-			errString:    "strconv.ParseBool",
-			remoteConfig: nil,
+			jsonRaw:   json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			env:       map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "d"},
+			arg:       "",
+			config:    Config{},
+			errString: "strconv.ParseBool",
+		},
+		"invalid_json_type": {
+			jsonRaw:   json.RawMessage(`{"keepTags":"yes"}`),
+			config:    Config{},
+			errString: "keepTags",
 		},
 		"remote_write_with_headers_json": {
-			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "apitoken":"token", "headers":{"X-Header":"value"}}`, u.String())),
 			env:     nil,
 			arg:     "",
 			config: Config{
 				Url:                   null.StringFrom(u.String()),
 				InsecureSkipTLSVerify: null.BoolFrom(true),
-				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.StringFrom("token"),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -165,20 +267,18 @@ func TestConstructRemoteConfig(t *testing.T) {
 					"X-Header": "value",
 				},
 			},
-			errString: "",
-
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
 		},
 		"remote_write_with_headers_env": {
-			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "apitoken":"token", "headers":{"X-Header":"value"}}`, u.String())),
 			env: map[string]string{
-				"K6_DYNATRACE_HEADER": "value_from_env",
+				"K6_DYNATRACE_HEADER_X-Header": "value_from_env",
 			},
 			arg: "",
 			config: Config{
 				Url:                   null.StringFrom(u.String()),
 				InsecureSkipTLSVerify: null.BoolFrom(true),
-				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.StringFrom("token"),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -187,20 +287,18 @@ func TestConstructRemoteConfig(t *testing.T) {
 					"X-Header": "value_from_env",
 				},
 			},
-			errString: "",
-
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
 		},
 		"remote_write_with_headers_arg": {
-			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "apitoken":"token", "headers":{"X-Header":"value"}}`, u.String())),
 			env: map[string]string{
-				"K6_DYNATRACE_HEADER": "value_from_env",
+				"K6_DYNATRACE_HEADER_X-Header": "value_from_env",
 			},
 			arg: "headers.X-Header=value_from_arg",
 			config: Config{
 				Url:                   null.StringFrom(u.String()),
 				InsecureSkipTLSVerify: null.BoolFrom(true),
-				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.StringFrom("token"),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -209,39 +307,308 @@ func TestConstructRemoteConfig(t *testing.T) {
 					"X-Header": "value_from_arg",
 				},
 			},
-			errString: "",
-
-			},
+			ingestUrl: u.String() + defaultDynatraceMetricEndPoint,
 		},
 	}
 
 	for name, testCase := range testCases {
 		testCase := testCase
 		t.Run(name, func(t *testing.T) {
-			c, err := GetConsolidatedConfig(testCase.jsonRaw, testCase.env, testCase.arg)
+			t.Parallel()
+
+			c, err := GetConsolidatedConfig(testCase.jsonRaw, testCase.script, testCase.env, testCase.arg)
 			if len(testCase.errString) > 0 {
-				assert.Contains(t, err.Error(), testCase.errString)
+				assert.ErrorContains(t, err, testCase.errString)
 				return
 			}
+			require.NoError(t, err)
 			assertConfig(t, c, testCase.config)
 
-			// there can be error only on url.Parse at the moment so skipping that
-			remoteConfig, _ := c.ConstructRemoteConfig()
-			assertRemoteConfig(t, remoteConfig, testCase.remoteConfig)
+			constructed, err := c.ConstructConfig()
+			require.NoError(t, err)
+			assert.Equal(t, testCase.ingestUrl, constructed.Url.String)
 		})
 	}
 }
 
 func assertConfig(t *testing.T, actual, expected Config) {
-	assert.Equal(t, expected.Mapping, actual.Mapping)
 	assert.Equal(t, expected.Url, actual.Url)
 	assert.Equal(t, expected.InsecureSkipTLSVerify, actual.InsecureSkipTLSVerify)
 	assert.Equal(t, expected.CACert, actual.CACert)
 	assert.Equal(t, expected.ApiToken, actual.ApiToken)
 	assert.Equal(t, expected.FlushPeriod, actual.FlushPeriod)
 	assert.Equal(t, expected.KeepTags, actual.KeepTags)
-	assert.Equal(t, expected.KeepNameTag, expected.KeepNameTag)
-	assert.Equal(t, expected.KeepUrlTag, expected.KeepUrlTag)
+	assert.Equal(t, expected.KeepNameTag, actual.KeepNameTag)
+	assert.Equal(t, expected.KeepUrlTag, actual.KeepUrlTag)
 	assert.Equal(t, expected.Headers, actual.Headers)
+	if expected.Dimensions == nil {
+		expected.Dimensions = make(map[string]string)
+	}
+	assert.Equal(t, expected.Dimensions, actual.Dimensions)
+}
+
+// configFieldSamples returns two distinct text values valid for the type of the option.
+func configFieldSamples(t *testing.T, f configField) (string, string) {
+	switch v := f.field(&Config{}).(type) {
+	case *null.String:
+		return f.key + "-first", f.key + "-second"
+	case *null.Bool:
+		return "true", "false"
+	case *null.Int:
+		return "3", "7"
+	case *null.Float:
+		return "0.3", "0.7"
+	case *types.NullDuration:
+		return "3s", "7s"
+	default:
+		t.Fatalf("no samples for option type %T of %s", v, f.key)
+		return "", ""
+	}
+}
+
+// TestConfigFields checks every option of the field table in all the config sources and their precedence.
+func TestConfigFields(t *testing.T) {
+	t.Parallel()
+
+	jsonTags := map[string]bool{}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if configType.Field(i).IsExported() {
+			jsonTags[strings.Split(configType.Field(i).Tag.Get("json"), ",")[0]] = true
+		}
+	}
+	assert.Len(t, configFields, len(jsonTags), "every Config field must be declared in configFields")
+
+	for _, f := range configFields {
+		f := f
+		t.Run(f.key, func(t *testing.T) {
+			t.Parallel()
+			assert.True(t, jsonTags[f.key], "the JSON tag must match the key")
+
+			if _, isMap := f.field(&Config{}).(*map[string]string); isMap {
+				// entry names which the environment variable keeps as they are
+				name := func(s string) string {
+					if f.envKey != nil {
+						return f.envKey(s)
+					}
+					return s
+				}
+				c, err := GetConsolidatedConfig(
+					json.RawMessage(`{"`+f.key+`":{"`+name("X-Json")+`":"json","`+name("X-Override")+`":"json"}}`),
+					json.RawMessage(`{"`+f.key+`":{"`+name("X-Script")+`":"script","`+name("X-Override")+`":"script"}}`),
+					map[string]string{f.env + name("X-Env"): "env", f.env + name("X-Override"): "env"},
+					f.key+"."+name("X-Arg")+"=arg,"+f.key+"."+name("X-Override")+"=arg")
+				require.NoError(t, err)
+				assert.Equal(t, &map[string]string{
+					name("X-Json"): "json", name("X-Script"): "script", name("X-Env"): "env", name("X-Arg"): "arg", name("X-Override"): "arg",
+				}, f.field(&c))
+				return
+			}
+
+			first, second := configFieldSamples(t, f)
+			expected := func(text string) interface{} {
+				c := Config{}
+				require.NoError(t, f.parseText(&c, text))
+				return f.field(&c)
+			}
+			jsonValue := strconv.Quote(first)
+			switch f.field(&Config{}).(type) {
+			case *null.Bool, *null.Int, *null.Float:
+				jsonValue = first
+			}
+			jsonConf := json.RawMessage(`{"` + f.key + `":` + jsonValue + `}`)
+
+			c, err := GetConsolidatedConfig(jsonConf, nil, nil, "")
+			require.NoError(t, err)
+			assert.Equal(t, expected(first), f.field(&c), "JSON")
+
+			c, err = GetConsolidatedConfig(nil, jsonConf, nil, "")
+			require.NoError(t, err)
+			assert.Equal(t, expected(first), f.field(&c), "script options")
+
+			c, err = GetConsolidatedConfig(jsonConf, nil, map[string]string{f.env: second}, "")
+			require.NoError(t, err)
+			assert.Equal(t, expected(second), f.field(&c), "environment over JSON")
+
+			c, err = GetConsolidatedConfig(nil, jsonConf, map[string]string{f.env: second}, "")
+			require.NoError(t, err)
+			assert.Equal(t, expected(second), f.field(&c), "environment over script options")
+
+			c, err = GetConsolidatedConfig(nil, nil, map[string]string{f.env: second}, f.key+"="+first)
+			require.NoError(t, err)
+			assert.Equal(t, expected(first), f.field(&c), "argument over environment")
+
+			c, err = GetConsolidatedConfig(nil, nil, nil, "")
+			require.NoError(t, err)
+			if len(f.def) > 0 {
+				assert.Equal(t, expected(f.def), f.field(&c), "default")
+			} else {
+				assert.False(t, reflect.ValueOf(f.field(&c)).Elem().FieldByName("Valid").Bool(), "no default")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	certFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(certFile, []byte("cert"), 0o600))
+
+	valid := NewConfig()
+	valid.Url = null.StringFrom("https://abc123.live.dynatrace.com")
+	valid.ApiToken = null.StringFrom("token")
+	valid.CACert = null.StringFrom(certFile)
+	valid.Headers["X-Header"] = "value"
+	assert.NoError(t, valid.Validate())
+
+	testCases := map[string]struct {
+		modify func(c *Config)
+		errs   []string
+	}{
+		"url_without_scheme": {
+			modify: func(c *Config) { c.Url = null.StringFrom("abc123.live.dynatrace.com") },
+			errs:   []string{"must start with http:// or https://"},
+		},
+		"url_with_ingest_path": {
+			modify: func(c *Config) { c.Url = null.StringFrom("https://abc123.live.dynatrace.com/api/v2/metrics/ingest") },
+			errs:   []string{"already contains the ingest path /api/v2/metrics/ingest"},
+		},
+		"custom_path_keeps_ingest_path": {
+			modify: func(c *Config) {
+				c.Url = null.StringFrom("https://abc123.live.dynatrace.com/api/v2/metrics/ingest")
+				c.EndpointMode = null.StringFrom("custom-path")
+			},
+		},
+		"zero_flush_period": {
+			modify: func(c *Config) { c.FlushPeriod = types.NullDurationFrom(0) },
+			errs:   []string{"flush period must be greater than 0"},
+		},
+		"invalid_header_name": {
+			modify: func(c *Config) { c.Headers["X Header"] = "value" },
+			errs:   []string{`header name "X Header" is invalid`},
+		},
+		"missing_ca_cert": {
+			modify: func(c *Config) { c.CACert = null.StringFrom(filepath.Join(t.TempDir(), "missing.crt")) },
+			errs:   []string{"CA certificate file can not be read"},
+		},
+		"invalid_prefix": {
+			modify: func(c *Config) { c.MetricPrefix = null.StringFrom("1k6..load") },
+			errs:   []string{`metric prefix "1k6..load" is invalid`},
+		},
+		"all_reported_at_once": {
+			modify: func(c *Config) {
+				c.Url = null.StringFrom("ftp://abc123.live.dynatrace.com/api/v2/metrics/ingest")
+				c.ApiToken = null.NewString("", false)
+				c.FlushPeriod = types.NullDurationFrom(-time.Second)
+				c.MetricPrefix = null.StringFrom("k6.")
+			},
+			errs: []string{
+				"must start with http:// or https://",
+				"already contains the ingest path",
+				"API token can not been empty",
+				"flush period must be greater than 0",
+				`metric prefix "k6." is invalid`,
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewConfig()
+			c.Url = valid.Url
+			c.ApiToken = valid.ApiToken
+			testCase.modify(&c)
+			err := c.Validate()
+			if len(testCase.errs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErrors ValidationErrors
+			require.ErrorAs(t, err, &validationErrors)
+			assert.Len(t, validationErrors, len(testCase.errs))
+			for _, errString := range testCase.errs {
+				assert.ErrorContains(t, err, errString)
+			}
+		})
+	}
+}
+
+func TestConfigFileProfiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "dynatrace.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+defaultProfile: dev
+profiles:
+  dev:
+    url: https://dev123.live.dynatrace.com
+    apiTokenFile: secrets/dev-token
+    flushPeriod: 5s
+    dimensions:
+      stage: dev
+  prod:
+    url: https://prod789.live.dynatrace.com
+    apiTokenFile: /var/run/secrets/prod-token
+    keepUrlTag: false
+`), 0o600))
+	jsonFile := filepath.Join(dir, "dynatrace.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"profiles":{"staging":{"url":"https://stag456.live.dynatrace.com"}}}`), 0o600))
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG_FILE": yamlFile}, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("https://dev123.live.dynatrace.com"), c.Url)
+	assert.Equal(t, null.StringFrom(filepath.Join(dir, "secrets/dev-token")), c.ApiTokenFile)
+	assert.Equal(t, types.NullDurationFrom(5*time.Second), c.FlushPeriod)
+	assert.Equal(t, map[string]string{"stage": "dev"}, c.Dimensions)
+
+	// environment and argument override the profile
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_DYNATRACE_CONFIG_FILE": yamlFile,
+		"K6_DYNATRACE_PROFILE":     "prod",
+		"K6_DYNATRACE_URL":         "https://override.live.dynatrace.com",
+	}, "keepUrlTag=true")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("https://override.live.dynatrace.com"), c.Url)
+	assert.Equal(t, null.StringFrom("/var/run/secrets/prod-token"), c.ApiTokenFile)
+	assert.Equal(t, null.BoolFrom(true), c.KeepUrlTag)
+
+	// the only profile is selected without K6_DYNATRACE_PROFILE
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG_FILE": jsonFile}, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("https://stag456.live.dynatrace.com"), c.Url)
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG_FILE": yamlFile, "K6_DYNATRACE_PROFILE": "qa"}, "")
+	assert.ErrorContains(t, err, `the profile "qa" does not exist, available are dev, prod`)
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG_FILE": filepath.Join(dir, "missing.yaml")}, "")
+	assert.ErrorContains(t, err, "config file can not be read")
 }
 
+func TestDeprecatedEnv(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_KEEP_TAGS":                    "false",
+		"K6_KEEP_URL_TAG":                 "false",
+		"K6_DYNATRACE_KEEP_URL_TAG":       "true",
+		"K6_DYNATRACE_HEADER_X_DT_SOURCE": "k6",
+		"K6_DYNATRACE_HEADER_X-Team":      "load",
+		"K6_DYNATRACE_HEADERX-Team":       "former",
+		"K6_DYNATRACE_HEADERX-Tenant":     "shop",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.BoolFrom(false), c.KeepTags)
+	assert.Equal(t, null.BoolFrom(true), c.KeepUrlTag, "the namespaced name takes precedence")
+	assert.Equal(t, map[string]string{"X-Dt-Source": "k6", "X-Team": "load", "X-Tenant": "shop"}, c.Headers,
+		"the former prefix keeps the name as is, the namespaced variables take precedence")
+	assert.Equal(t, []string{
+		"The environment variable K6_DYNATRACE_HEADERX-Team is deprecated, use the K6_DYNATRACE_HEADER_ prefix instead",
+		"The environment variable K6_DYNATRACE_HEADERX-Tenant is deprecated, use the K6_DYNATRACE_HEADER_ prefix instead",
+		"The environment variable K6_KEEP_TAGS is deprecated, use K6_DYNATRACE_KEEP_TAGS instead",
+	}, c.warnings)
+}
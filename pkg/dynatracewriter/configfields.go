@@ -0,0 +1,218 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+// configField describes one option of the output. The type of the option is taken from the
+// field of the Config it points to, so parsing is the same for all the sources.
+type configField struct {
+	// key is the name in the JSON config and in the -o argument
+	key string
+	// env is the environment variable, for maps the prefix of the variables holding the entries
+	env string
+	// def is the default in its text form, empty for options without a default
+	def string
+	// deprecatedEnv are former names of the environment variable, still read but logged as deprecated,
+	// for maps the former prefixes
+	deprecatedEnv []string
+	// envKey converts the suffix of a map variable to the key of the entry, the suffix is used as is when nil
+	envKey func(suffix string) string
+	// isPath marks options holding a file name, relative names in a config file are resolved against its directory
+	isPath bool
+	// field returns a pointer to the option in the given config
+	field func(c *Config) interface{}
+}
+
+func (f configField) setDefault(c *Config) {
+	if m, ok := f.field(c).(*map[string]string); ok {
+		*m = make(map[string]string)
+		return
+	}
+	if len(f.def) > 0 {
+		if err := f.parseText(c, f.def); err != nil {
+			panic(fmt.Sprintf("invalid default %q for %s: %v", f.def, f.key, err))
+		}
+	}
+}
+
+// parseText sets the option from its text form, as used in environment variables and defaults.
+func (f configField) parseText(c *Config, text string) error {
+	var err error
+	switch v := f.field(c).(type) {
+	case *null.String:
+		*v = null.StringFrom(text)
+	case *null.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(text); err == nil {
+			*v = null.BoolFrom(b)
+		}
+	case *null.Int:
+		var i int64
+		if i, err = strconv.ParseInt(text, 10, 64); err == nil {
+			*v = null.IntFrom(i)
+		}
+	case *null.Float:
+		var f float64
+		if f, err = strconv.ParseFloat(text, 64); err == nil {
+			*v = null.FloatFrom(f)
+		}
+	case *types.NullDuration:
+		err = v.UnmarshalText([]byte(text))
+	default:
+		err = fmt.Errorf("unsupported option type %T", v)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", text, f.key, err)
+	}
+	return nil
+}
+
+// parseJSON sets the option from its value in the JSON config.
+func (f configField) parseJSON(c *Config, raw json.RawMessage) error {
+	if err := json.Unmarshal(raw, f.field(c)); err != nil {
+		return fmt.Errorf("invalid value %s for %s: %w", string(raw), f.key, err)
+	}
+	return nil
+}
+
+// parseArg sets the option from its value in the -o argument, which is already typed by strvals.
+func (f configField) parseArg(c *Config, value interface{}) error {
+	if m, ok := f.field(c).(*map[string]string); ok {
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid value %v for %s: expected %s.<name>=<value>", value, f.key, f.key)
+		}
+		*m = make(map[string]string, len(entries))
+		for k, v := range entries {
+			(*m)[k] = argText(v)
+		}
+		return nil
+	}
+	return f.parseText(c, argText(value))
+}
+
+// argText converts a value typed by strvals back to text, a list like {a,b} becomes "a,b" again.
+func argText(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// parseEnv sets the option from the environment, if it is defined there.
+// A deprecated name is only used when the current one is not defined and is reported in the warnings.
+func (f configField) parseEnv(c *Config, env map[string]string) (warnings []string, err error) {
+	if m, ok := f.field(c).(*map[string]string); ok {
+		set := func(key, value string) {
+			if *m == nil {
+				*m = make(map[string]string)
+			}
+			(*m)[key] = value
+		}
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		// the entries under a deprecated prefix keep their suffix as key and are overridden by the current ones
+		for _, deprecated := range f.deprecatedEnv {
+			for _, name := range names {
+				if strings.HasPrefix(name, deprecated) && len(name) > len(deprecated) && !strings.HasPrefix(name, f.env) {
+					warnings = append(warnings, fmt.Sprintf("The environment variable %s is deprecated, use the %s prefix instead", name, f.env))
+					set(strings.TrimPrefix(name, deprecated), env[name])
+				}
+			}
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, f.env) && len(name) > len(f.env) {
+				key := strings.TrimPrefix(name, f.env)
+				if f.envKey != nil {
+					key = f.envKey(key)
+				}
+				set(key, env[name])
+			}
+		}
+		return warnings, nil
+	}
+	if value, defined := env[f.env]; defined {
+		return nil, f.parseText(c, value)
+	}
+	for _, deprecated := range f.deprecatedEnv {
+		if value, defined := env[deprecated]; defined {
+			warnings = append(warnings, fmt.Sprintf("The environment variable %s is deprecated, use %s instead", deprecated, f.env))
+			return warnings, f.parseText(c, value)
+		}
+	}
+	return nil, nil
+}
+
+// headerNameFromEnv converts the suffix of a K6_DYNATRACE_HEADER_ variable to a header name, X_FOO becomes X-Foo.
+func headerNameFromEnv(suffix string) string {
+	return http.CanonicalHeaderKey(strings.ReplaceAll(suffix, "_", "-"))
+}
+
+// metricNameFromEnv converts the suffix of a variable naming a metric to the metric name, HTTP_REQ_DURATION becomes http_req_duration.
+func metricNameFromEnv(suffix string) string {
+	return strings.ToLower(suffix)
+}
+
+// resolvePath makes a relative file name in the option relative to dir.
+func (f configField) resolvePath(c *Config, dir string) {
+	if v, ok := f.field(c).(*null.String); ok && v.Valid && len(v.String) > 0 && !filepath.IsAbs(v.String) {
+		*v = null.StringFrom(filepath.Join(dir, v.String))
+	}
+}
+
+// apply copies the option from applied to base if it is set in applied.
+func (f configField) apply(base, applied *Config) {
+	switch dst := f.field(base).(type) {
+	case *null.String:
+		if src := f.field(applied).(*null.String); src.Valid {
+			*dst = *src
+		}
+	case *null.Bool:
+		if src := f.field(applied).(*null.Bool); src.Valid {
+			*dst = *src
+		}
+	case *null.Int:
+		if src := f.field(applied).(*null.Int); src.Valid {
+			*dst = *src
+		}
+	case *null.Float:
+		if src := f.field(applied).(*null.Float); src.Valid {
+			*dst = *src
+		}
+	case *types.NullDuration:
+		if src := f.field(applied).(*types.NullDuration); src.Valid {
+			*dst = *src
+		}
+	case *map[string]string:
+		if src := f.field(applied).(*map[string]string); len(*src) > 0 {
+			merged := make(map[string]string, len(*dst)+len(*src))
+			for k, v := range *dst {
+				merged[k] = v
+			}
+			for k, v := range *src {
+				merged[k] = v
+			}
+			*dst = merged
+		}
+	default:
+		panic(fmt.Sprintf("unsupported option type %T for %s", dst, f.key))
+	}
+}
@@ -0,0 +1,107 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileEnv = "K6_DYNATRACE_CONFIG_FILE"
+	profileEnv    = "K6_DYNATRACE_PROFILE"
+)
+
+// configFile is an external YAML or JSON file holding the settings of several Dynatrace environments:
+//
+//	defaultProfile: dev
+//	profiles:
+//	  dev:
+//	    url: https://abc123.live.dynatrace.com
+//	    apiTokenFile: secrets/dev-token
+//	    dimensions:
+//	      stage: dev
+//	  prod:
+//	    url: https://xyz789.live.dynatrace.com
+//	    apiTokenFile: secrets/prod-token
+type configFile struct {
+	DefaultProfile string                            `json:"defaultProfile" yaml:"defaultProfile"`
+	Profiles       map[string]map[string]interface{} `json:"profiles" yaml:"profiles"`
+}
+
+// parseProfile reads the config file named by K6_DYNATRACE_CONFIG_FILE and converts the profile
+// selected by K6_DYNATRACE_PROFILE to a config. Without a config file it returns an empty config.
+func parseProfile(env map[string]string) (Config, error) {
+	path, defined := env[configFileEnv]
+	if !defined || len(path) == 0 {
+		return Config{}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("The Dynatrace config file can not be read: %w", err)
+	}
+	var file configFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, &file)
+	} else {
+		err = yaml.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("The Dynatrace config file %s is invalid: %w", path, err)
+	}
+
+	name, err := file.selectProfile(env[profileEnv])
+	if err != nil {
+		return Config{}, fmt.Errorf("%w in the Dynatrace config file %s", err, path)
+	}
+
+	// the profile goes through the JSON parsing, so it supports the same keys and types as the JSON config
+	raw, err := json.Marshal(file.Profiles[name])
+	if err != nil {
+		return Config{}, fmt.Errorf("The profile %q in the Dynatrace config file %s is invalid: %w", name, path, err)
+	}
+	c, err := parseJSON(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("The profile %q in the Dynatrace config file %s is invalid: %w", name, path, err)
+	}
+
+	// relative file names in a profile are relative to the config file
+	for _, f := range configFields {
+		if f.isPath {
+			f.resolvePath(&c, filepath.Dir(path))
+		}
+	}
+	return c, nil
+}
+
+// selectProfile returns the requested profile, the default profile or the only profile of the file.
+func (file configFile) selectProfile(requested string) (string, error) {
+	name := requested
+	if len(name) == 0 {
+		name = file.DefaultProfile
+	}
+	if len(name) == 0 && len(file.Profiles) == 1 {
+		for only := range file.Profiles {
+			name = only
+		}
+	}
+
+	names := make([]string, 0, len(file.Profiles))
+	for n := range file.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if len(name) == 0 {
+		return "", fmt.Errorf("no profile selected, set %s to one of %s", profileEnv, strings.Join(names, ", "))
+	}
+	if _, ok := file.Profiles[name]; !ok {
+		return "", fmt.Errorf("the profile %q does not exist, available are %s", name, strings.Join(names, ", "))
+	}
+	return name, nil
+}
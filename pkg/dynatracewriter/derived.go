@@ -0,0 +1,22 @@
+package dynatracewriter
+
+import (
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// deriveMetrics computes the metrics derived from the samples of a flush, they are sent along with the converted samples.
+func (o *Output) deriveMetrics(samplesContainers []metrics.SampleContainer, converted []dynatraceMetric, now time.Time) []dynatraceMetric {
+	var derived []dynatraceMetric
+	if o.config.TrendPercentiles.Bool {
+		derived = append(derived, o.trendPercentiles(converted, now)...)
+	}
+	if len(o.config.HistogramBuckets) > 0 {
+		derived = append(derived, o.histogramBuckets(converted, now)...)
+	}
+	if o.config.Apdex.Bool {
+		derived = append(derived, o.apdexMetrics(samplesContainers, now)...)
+	}
+	return derived
+}
@@ -14,6 +14,7 @@ const (
     metricKeyPrefix="k6"
 )
 type dynatraceMetric struct{
+    metricKeyPrefix string
     metricDisplayName string
     description string
     metricKeyName string
@@ -21,6 +22,12 @@ type dynatraceMetric struct{
     metricDimensions map[string]string
     metricValue float64
     metricTimeStamp int64
+    // metricType selects the OTLP data point, the line protocol sends every metric as gauge
+    metricType metrics.MetricType
+    // countDelta sends the value as count,delta instead of a gauge in the line protocol
+    countDelta bool
+    // metricSummary sends the min, max, sum and count of an aggregation window instead of a single value
+    metricSummary *gaugeSummary
 }
 
 
@@ -30,6 +37,7 @@ func samleToDynametric(sample metrics.Sample ) dynatraceMetric {
         metricDimensions : sample.GetTags().Map(),
         metricValue : sample.Value,
         metricTimeStamp : sample.GetTime().UnixMilli(),
+        metricType : sample.Metric.Type,
      }
 }
 
@@ -38,7 +46,11 @@ func (e *dynatraceMetric) toText() string {
 
    var result=""
 
-   result=metricKeyPrefix+"."+e.metricKeyName
+   prefix:=e.metricKeyPrefix
+   if len(prefix)==0 {
+        prefix=metricKeyPrefix
+   }
+   result=prefix+"."+e.metricKeyName
 
    if(len(e.metricDimensions)!=0) {
         for key, value := range e.metricDimensions {
@@ -62,7 +74,13 @@ func (e *dynatraceMetric) toText() string {
             result+=","+metricDisplayNameProperty+"="+e.metricDisplayName
     }
 
-    result+=" "+ fmt.Sprint(e.metricValue)
+    if e.countDelta {
+        result+=" count,delta="+ fmt.Sprint(e.metricValue)
+    } else if e.metricSummary != nil {
+        result+=fmt.Sprintf(" gauge,min=%v,max=%v,sum=%v,count=%d", e.metricSummary.min, e.metricSummary.max, e.metricSummary.sum, e.metricSummary.count)
+    } else {
+        result+=" "+ fmt.Sprint(e.metricValue)
+    }
 
     if e.metricTimeStamp<= 0 {
         t := time.Now() //It will return time.Time object with current timestamp
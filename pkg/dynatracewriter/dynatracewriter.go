@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"time"
     "net/http"
-    "io/ioutil"
 	//nolint:staticcheck
     "bytes"
+	"sync"
 	"github.com/sirupsen/logrus"
 	"go.k6.io/k6/output"
 	"go.k6.io/k6/metrics"
@@ -18,6 +18,22 @@ type Output struct {
 	output.SampleBuffer
     params  output.Params
 	logger logrus.FieldLogger
+	auth   authProvider
+	client *http.Client
+	retryBackoff time.Duration
+	testRun testRun
+	thresholds map[string]metrics.Thresholds
+	liveThresholds *thresholdEvaluator
+	lastFlush      time.Time
+	stopTestRun    func(error)
+	failedFlushes  int
+	testRunStopped bool
+	logShipper     *logShipper
+	summary        runSummary
+	aggregator     *windowAggregator
+	cardinality    cardinalityLimiter
+	metricFilter   *metricFilter
+	queuedRunStatus []dynatraceMetric
 }
 
 var _ output.Output = new(Output)
@@ -25,20 +41,54 @@ var _ output.Output = new(Output)
 // toggle to indicate whether we should stop dropping samples
 var flushTooLong bool
 
+// warnings which were already logged, so each is logged only once per process
+var loggedWarnings sync.Map
+
+func warnOnce(logger logrus.FieldLogger, warning string) {
+	if _, logged := loggedWarnings.LoadOrStore(warning, true); !logged {
+		logger.Warn("Dynatrace: " + warning)
+	}
+}
+
 func New(params output.Params) (*Output, error) {
-	config, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
+	config, err := GetConsolidatedConfig(params.JSONConfig, params.ScriptOptions.External[scriptOptionsKey],
+		params.Environment, params.ConfigArgument)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, warning := range config.warnings {
+		warnOnce(params.Logger, warning)
+	}
+
 	newconfig, err := config.ConstructConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	client, err := newHTTPClient(newconfig)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := newAuthProvider(newconfig, client)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newMetricFilter(newconfig)
+	if err != nil {
+		return nil, err
+	}
+	params.Logger.Debug("Dynatrace: using config " + newconfig.String())
+
 	return &Output{
-		config:  newconfig,
-		logger:  params.Logger,
+		config:       newconfig,
+		params:       params,
+		logger:       params.Logger,
+		metricFilter: filter,
+		auth:         auth,
+		client:       client,
+		retryBackoff: defaultRetryBackoff,
+		testRun:      newTestRun(newconfig.TestRunId.String, params),
 	}, nil
 }
 
@@ -47,19 +97,81 @@ func (*Output) Description() string {
 }
 
 func (o *Output) Start() error {
+	if o.config.Preflight.Bool {
+		if err := o.preflight(); err != nil {
+			return err
+		}
+	}
+	o.testRun.startTime = time.Now()
+	o.lastFlush = o.testRun.startTime
+	if o.config.LiveThresholds.Bool && len(o.thresholds) > 0 {
+		var errs []error
+		o.liveThresholds, errs = newThresholdEvaluator(o.thresholds)
+		for _, err := range errs {
+			o.logger.WithError(err).Warn("Dynatrace: the threshold is not evaluated during the test")
+		}
+	}
+
+	if window := time.Duration(o.config.AggregationWindow.Duration); window > 0 {
+		o.aggregator = newWindowAggregator(window, time.Duration(o.config.FlushPeriod.Duration))
+	}
+	// queued before the flusher starts, the flushes take the queue without a lock
+	o.queueRunStatus(runStatusRunning, o.testRun.startTime)
+
 	if periodicFlusher, err := output.NewPeriodicFlusher(time.Duration(o.config.FlushPeriod.Duration), o.flush); err != nil {
 		return err
 	} else {
 		o.periodicFlusher = periodicFlusher
 	}
+	if o.config.Logs.Bool {
+		if err := o.startLogShipping(); err != nil {
+			return err
+		}
+	}
 	o.logger.Debug("Dynatrace: starting dynatrace-write")
 
+	if o.config.Events.Bool {
+		if err := o.sendEvent(o.testStartEvent()); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the test start event")
+		}
+	}
+
 	return nil
 }
 
 func (o *Output) Stop() error {
+	return o.StopWithTestError(nil)
+}
+
+// StopWithTestError is called by k6 instead of Stop, testRunErr tells why the test run ended.
+func (o *Output) StopWithTestError(testRunErr error) error {
 	o.logger.Debug("Dynatrace: stopping dynatrace-write")
 	o.periodicFlusher.Stop()
+	if o.aggregator != nil {
+		for _, window := range o.aggregator.drain() {
+			o.sendWindow(window)
+		}
+	}
+	o.reportThresholds()
+	o.cardinality.report(o.logger, int(o.config.MaxSeriesPerMetric.Int64))
+
+	end := time.Now()
+	status := runStatusFromError(testRunErr)
+	o.reportRunStatus(status, end)
+	if o.config.Events.Bool {
+		if err := o.sendEvent(o.testEndEvent(end, status)); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the test end event")
+		}
+	}
+	if o.config.SummaryEvent.Bool {
+		if err := o.sendSummaryEvent(o.summaryEvent(end, status)); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the test summary")
+		}
+	}
+	if o.logShipper != nil {
+		o.logShipper.close()
+		o.flushLogs()
+	}
 	return nil
 }
 
@@ -84,6 +196,12 @@ func (o *Output) flush() {
 	}()
 
 	samplesContainers := o.GetBufferedSamples()
+	o.evaluateLiveThresholds(samplesContainers, start)
+	o.exportFailedRequests(samplesContainers)
+	o.exportTraces(samplesContainers)
+	if o.config.SummaryEvent.Bool {
+		o.summary.add(samplesContainers)
+	}
 
 	// Remote write endpoint accepts TimeSeries structure defined in gRPC. It must:
 	// a) contain Labels array
@@ -91,43 +209,86 @@ func (o *Output) flush() {
 	// as a metric without a name. This behaviour depends on underlying storage used.
 	// c) not have duplicate timestamps within 1 timeseries, see https://github.com/prometheus/prometheus/issues/9210
 	// Prometheus write handler processes only some fields as of now, so here we'll add only them.
+	if o.aggregator != nil {
+		if queued := o.takeQueuedRunStatus(); len(queued) > 0 {
+			o.recordFlush(o.sendMetrics(queued))
+		}
+		o.aggregator.add(samplesContainers)
+		for _, window := range o.aggregator.closed(start) {
+			nts += o.sendWindow(window)
+		}
+		o.flushLogs()
+		return
+	}
+
 	dynatraceMetric := o.convertToTimeDynatraceData(samplesContainers)
+	dynatraceMetric = append(dynatraceMetric, o.deriveMetrics(samplesContainers, dynatraceMetric, start)...)
+	dynatraceMetric = append(dynatraceMetric, o.takeQueuedRunStatus()...)
 	nts = len(dynatraceMetric)
     if nts > 0 {
              o.logger.WithField("nts", nts).Debug("Converted samples to time series in preparation for sending.")
 
-            var payload=generatePayload(dynatraceMetric)
-
-        	request, error := http.NewRequest( "POST", o.config.Url, bytes.NewBuffer([]byte(payload)))
-
-        	for key,value := range o.config.Headers {
-        	    request.Header.Set(key, value)
-        	}
-            o.logger.Debug("Payload to send " + payload)
-            client := &http.Client{}
-            response, error := client.Do(request)
-            if error != nil {
-                o.logger.WithError(error).Fatal("Failed to send timeseries.")
-            }
-            o.logger.Debug("response Status:" + response.Status)
-            defer response.Body.Close()
-
-
-            var b=""
-            for key, value := range  response.Header {
-                 for _, singlevalue := range value {
-                    b+=key+"="+singlevalue+"\n"
-                 }
-            }
-            o.logger.Debug("response Headers:" + b)
-            body, _ := ioutil.ReadAll(response.Body)
-            o.logger.Debug("response Body:"+ string(body))
+            o.recordFlush(o.sendMetrics(dynatraceMetric))
     } else {
          o.logger.Debug("no data to send")
     }
+	o.flushLogs()
 
 }
 
+// sendMetrics posts the metrics in the configured protocol to the metrics ingest endpoint.
+func (o *Output) sendMetrics(dynatraceMetrics []dynatraceMetric) error {
+	var payload []byte
+	if Protocol(o.config.Protocol.String) == ProtocolOTLP {
+		var err error
+		if payload, err = o.otlpMetricsPayload(dynatraceMetrics); err != nil {
+			return err
+		}
+		o.logger.Debug(fmt.Sprintf("OTLP payload to send: %d metrics, %d bytes", len(dynatraceMetrics), len(payload)))
+	} else {
+		payload = []byte(generatePayload(dynatraceMetrics))
+		o.logger.Debug("Payload to send " + string(payload))
+	}
+
+	response, err := o.post(o.config.Url.String, "", payload)
+	if err != nil {
+		return err
+	}
+	switch {
+	case response.statusCode == http.StatusUnauthorized || response.statusCode == http.StatusForbidden:
+		return fmt.Errorf("%w, the metrics ingest responded with %s: %s", errAuthentication, response.status, string(response.body))
+	case response.statusCode == http.StatusBadRequest && Protocol(o.config.Protocol.String) != ProtocolOTLP:
+		// the valid lines of the payload are still ingested, the response lists the invalid ones
+		o.logger.Warn("Dynatrace: some metric lines were rejected: " + string(response.body))
+	case response.statusCode >= 300:
+		return fmt.Errorf("the metrics ingest responded with %s: %s", response.status, string(response.body))
+	}
+	return nil
+}
+
+// newRequest creates a POST request to a Dynatrace API with the configured headers and authentication.
+// An empty content type keeps the one of the metrics ingest.
+func (o *Output) newRequest(url string, contentType string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range o.config.Headers {
+		request.Header.Set(key, value)
+	}
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if o.auth != nil {
+		if err := o.auth.authorize(request); err != nil {
+			// the provider may fail temporarily, e.g. while the token endpoint is unavailable, so this is retried
+			// and counts as failed flush, only the ingest responding with 401 or 403 marks the credentials as rejected
+			return nil, fmt.Errorf("Failed to authorize the request: %w", err)
+		}
+	}
+	return request, nil
+}
+
 func generatePayload(dynatraceMetrics []dynatraceMetric) string {
 
     var result=""
@@ -138,6 +299,25 @@ func generatePayload(dynatraceMetrics []dynatraceMetric) string {
     return result
 }
 
+// dimensions filters the sample tags according to the keep options and adds the configured dimensions,
+// tags of the sample take precedence over configured dimensions with the same name.
+func (o *Output) dimensions(tags map[string]string) map[string]string {
+	dimensions := make(map[string]string, len(tags)+len(o.config.Dimensions))
+	for k, v := range o.config.Dimensions {
+		dimensions[k] = v
+	}
+	if !o.config.KeepTags.Bool {
+		return dimensions
+	}
+	for k, v := range tags {
+		if (k == "name" && !o.config.KeepNameTag.Bool) || (k == "url" && !o.config.KeepUrlTag.Bool) {
+			continue
+		}
+		dimensions[k] = v
+	}
+	return dimensions
+}
+
 func (o *Output) convertToTimeDynatraceData(samplesContainers []metrics.SampleContainer) []dynatraceMetric {
 	var dynTimeSeries []dynatraceMetric
 
@@ -145,6 +325,9 @@ func (o *Output) convertToTimeDynatraceData(samplesContainers []metrics.SampleCo
 		samples := samplesContainer.GetSamples()
 
 		for _, sample := range samples {
+			if !o.metricFilter.allows(sample.Metric) {
+				continue
+			}
 			// Prometheus remote write treats each label array in TimeSeries as the same
 			// for all Samples in those TimeSeries (https://github.com/prometheus/prometheus/blob/03d084f8629477907cab39fc3d314b375eeac010/storage/remote/write_handler.go#L75).
 			// But K6 metrics can have different tags per each Sample so in order not to
@@ -152,6 +335,9 @@ func (o *Output) convertToTimeDynatraceData(samplesContainers []metrics.SampleCo
 			// This approach also allows to avoid hard to replicate issues with duplicate timestamps.
 
             dynametric := samleToDynametric( sample)
+            dynametric.metricKeyPrefix = o.config.MetricPrefix.String
+            dynametric.metricDimensions = o.cardinality.limit(int(o.config.MaxSeriesPerMetric.Int64),
+                dynametric.metricKeyName, o.dimensions(dynametric.metricDimensions), o.config.Dimensions)
             if &dynametric.metricValue != nil {
                 o.logger.Debug("metric name : " + dynametric.metricKeyName)
                 dynTimeSeries = append  (dynTimeSeries, dynametric)
@@ -0,0 +1,51 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+// newTestOutput returns an Output which sends to a test server with the handler, authenticated with the API token "token".
+// configure adjusts the config before it is constructed, the URL of the test server is already set.
+func newTestOutput(t *testing.T, handler http.HandlerFunc, configure func(*Config)) *Output {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := NewConfig()
+	c.Url = null.StringFrom(server.URL)
+	c.ApiToken = null.StringFrom("token")
+	if configure != nil {
+		configure(&c)
+	}
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	auth, err := newAuthProvider(constructed, server.Client())
+	require.NoError(t, err)
+	return &Output{config: constructed, logger: logrus.New(), auth: auth, client: server.Client()}
+}
+
+func TestDimensions(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"name": "http://shop/cart", "url": "http://shop/cart", "method": "GET", "test": "from-tag"}
+
+	c := NewConfig()
+	c.Dimensions = map[string]string{"test": "checkout", "team": "shop"}
+	o := &Output{config: &c}
+	assert.Equal(t, map[string]string{"url": "http://shop/cart", "method": "GET", "test": "from-tag", "team": "shop"}, o.dimensions(tags))
+
+	c.KeepNameTag = null.BoolFrom(true)
+	c.KeepUrlTag = null.BoolFrom(false)
+	assert.Equal(t, map[string]string{"name": "http://shop/cart", "method": "GET", "test": "from-tag", "team": "shop"}, o.dimensions(tags))
+
+	c.KeepTags = null.BoolFrom(false)
+	assert.Equal(t, map[string]string{"test": "checkout", "team": "shop"}, o.dimensions(tags))
+}
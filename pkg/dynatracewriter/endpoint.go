@@ -0,0 +1,109 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// EndpointMode selects how the metrics ingest URL is built and whether an
+// API token is required to talk to it.
+type EndpointMode string
+
+const (
+	// EndpointModeSaaS targets a Dynatrace SaaS or Managed environment, e.g. https://<environmentid>.live.dynatrace.com
+	EndpointModeSaaS EndpointMode = "saas"
+	// EndpointModeActiveGate targets an environment ActiveGate, e.g. https://<activegate>:9999/e/<environmentid>
+	EndpointModeActiveGate EndpointMode = "activegate"
+	// EndpointModeOneAgent targets the local, unauthenticated OneAgent metrics ingest
+	EndpointModeOneAgent EndpointMode = "oneagent"
+	// EndpointModeCustomPath sends to the configured URL as is, without appending any path
+	EndpointModeCustomPath EndpointMode = "custom-path"
+)
+
+const (
+	defaultOneAgentUrl              = "http://localhost:14499"
+	defaultOneAgentMetricEndPoint   = "/metrics/ingest"
+	activeGateEnvironmentPathPrefix = "/e/"
+)
+
+// ParseEndpointMode converts the configured value to an EndpointMode, an empty value means auto-detection.
+func ParseEndpointMode(s string) (EndpointMode, error) {
+	switch m := EndpointMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "", EndpointModeSaaS, EndpointModeActiveGate, EndpointModeOneAgent, EndpointModeCustomPath:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown Dynatrace endpoint mode %q, expected one of %s, %s, %s or %s",
+			s, EndpointModeSaaS, EndpointModeActiveGate, EndpointModeOneAgent, EndpointModeCustomPath)
+	}
+}
+
+// requiresApiToken reports whether requests to this kind of endpoint have to be authenticated.
+func (m EndpointMode) requiresApiToken() bool {
+	return m == EndpointModeSaaS || m == EndpointModeActiveGate
+}
+
+// detectEndpointMode guesses the endpoint mode from the configured URL.
+// Without any URL the local OneAgent ingest is the only endpoint we can reach.
+func detectEndpointMode(rawUrl string) EndpointMode {
+	if len(rawUrl) == 0 {
+		return EndpointModeOneAgent
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return EndpointModeSaaS
+	}
+	if strings.HasPrefix(u.Path, activeGateEnvironmentPathPrefix) {
+		return EndpointModeActiveGate
+	}
+	if u.Port() == "14499" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1") {
+		return EndpointModeOneAgent
+	}
+	return EndpointModeSaaS
+}
+
+// endpointMode returns the configured endpoint mode or the one detected from the URL.
+func (conf Config) endpointMode() (EndpointMode, error) {
+	mode, err := ParseEndpointMode(conf.EndpointMode.String)
+	if err != nil || len(mode) > 0 {
+		return mode, err
+	}
+	return detectEndpointMode(conf.Url.String), nil
+}
+
+// ingestUrl builds the full metrics ingest URL of the protocol for the given base URL.
+func (m EndpointMode) ingestUrl(baseUrl string, protocol Protocol) (*url.URL, error) {
+	base := strings.TrimSuffix(baseUrl, "/")
+	switch m {
+	case EndpointModeCustomPath:
+		// keep the URL as configured
+	case EndpointModeOneAgent:
+		if len(base) == 0 {
+			base = defaultOneAgentUrl
+		}
+		if protocol == ProtocolOTLP {
+			base += defaultOneAgentOtlpMetricEndPoint
+		} else {
+			base += defaultOneAgentMetricEndPoint
+		}
+	default:
+		if protocol == ProtocolOTLP {
+			base += defaultOtlpMetricEndPoint
+		} else {
+			base += defaultDynatraceMetricEndPoint
+		}
+	}
+	return url.Parse(base)
+}
+
+// apiUrl builds the URL of another Dynatrace API from the constructed metrics ingest URL.
+// Only SaaS and ActiveGate endpoints serve the other APIs.
+func (conf *Config) apiUrl(path string) (string, error) {
+	mode := EndpointMode(conf.EndpointMode.String)
+	if mode != EndpointModeSaaS && mode != EndpointModeActiveGate {
+		return "", fmt.Errorf("%s is not available for the %s endpoint mode", path, mode)
+	}
+	base := strings.TrimSuffix(conf.Url.String, defaultDynatraceMetricEndPoint)
+	base = strings.TrimSuffix(base, defaultOtlpMetricEndPoint)
+	return base + path, nil
+}
@@ -0,0 +1,111 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConstructConfigEndpointModes(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		url       string
+		mode      string
+		protocol  string
+		apiToken  string
+		ingestUrl string
+		errString string
+	}{
+		"saas_detected": {
+			url:       "https://abc123.live.dynatrace.com",
+			apiToken:  "token",
+			ingestUrl: "https://abc123.live.dynatrace.com/api/v2/metrics/ingest",
+		},
+		"activegate_detected": {
+			url:       "https://activegate:9999/e/abc123/",
+			apiToken:  "token",
+			ingestUrl: "https://activegate:9999/e/abc123/api/v2/metrics/ingest",
+		},
+		"oneagent_detected_without_url": {
+			ingestUrl: "http://localhost:14499/metrics/ingest",
+		},
+		"oneagent_explicit_url": {
+			url:       "http://127.0.0.1:14499",
+			mode:      "oneagent",
+			ingestUrl: "http://127.0.0.1:14499/metrics/ingest",
+		},
+		"custom_path": {
+			url:       "https://proxy.internal/dynatrace/ingest",
+			mode:      "custom-path",
+			ingestUrl: "https://proxy.internal/dynatrace/ingest",
+		},
+		"saas_otlp": {
+			url:       "https://abc123.live.dynatrace.com",
+			protocol:  "otlp",
+			apiToken:  "token",
+			ingestUrl: "https://abc123.live.dynatrace.com/api/v2/otlp/v1/metrics",
+		},
+		"activegate_otlp": {
+			url:       "https://activegate:9999/e/abc123",
+			protocol:  "otlp",
+			apiToken:  "token",
+			ingestUrl: "https://activegate:9999/e/abc123/api/v2/otlp/v1/metrics",
+		},
+		"oneagent_otlp": {
+			protocol:  "otlp",
+			ingestUrl: "http://localhost:14499/otlp/v1/metrics",
+		},
+		"unknown_protocol": {
+			url:       "https://abc123.live.dynatrace.com",
+			protocol:  "prometheus",
+			apiToken:  "token",
+			errString: "unknown metrics protocol",
+		},
+		"saas_without_token": {
+			url:       "https://abc123.live.dynatrace.com",
+			mode:      "saas",
+			errString: "API token",
+		},
+		"custom_path_without_url": {
+			mode:      "custom-path",
+			errString: "URL is required",
+		},
+		"unknown_mode": {
+			url:       "https://abc123.live.dynatrace.com",
+			mode:      "cluster",
+			errString: "unknown Dynatrace endpoint mode",
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewConfig()
+			c.Url = null.NewString(testCase.url, len(testCase.url) > 0)
+			if len(testCase.mode) > 0 {
+				c.EndpointMode = null.StringFrom(testCase.mode)
+			}
+			if len(testCase.protocol) > 0 {
+				c.Protocol = null.StringFrom(testCase.protocol)
+			}
+			if len(testCase.apiToken) > 0 {
+				c.ApiToken = null.StringFrom(testCase.apiToken)
+			}
+
+			constructed, err := c.ConstructConfig()
+			if len(testCase.errString) > 0 {
+				assert.ErrorContains(t, err, testCase.errString)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.ingestUrl, constructed.Url.String)
+			auth, err := newAuthProvider(constructed, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, len(testCase.apiToken) > 0, auth != nil)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package dynatracewriter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/output"
+)
+
+const (
+	defaultEventsEndPoint = "/api/v2/events/ingest"
+	defaultEventType      = "CUSTOM_INFO"
+)
+
+// eventTypes are the event types accepted by the Events API v2
+var eventTypes = []string{
+	"AVAILABILITY_EVENT", "CUSTOM_ALERT", "CUSTOM_ANNOTATION", "CUSTOM_CONFIGURATION", "CUSTOM_DEPLOYMENT",
+	"CUSTOM_INFO", "ERROR_EVENT", "MARKED_FOR_TERMINATION", "PERFORMANCE_EVENT", "RESOURCE_CONTENTION_EVENT",
+}
+
+// dynatraceEvent is the payload of the Events API v2
+type dynatraceEvent struct {
+	EventType      string            `json:"eventType"`
+	Title          string            `json:"title"`
+	StartTime      int64             `json:"startTime,omitempty"`
+	EndTime        int64             `json:"endTime,omitempty"`
+	EntitySelector string            `json:"entitySelector,omitempty"`
+	Properties     map[string]string `json:"properties,omitempty"`
+}
+
+// testRun describes the running test, it is attached to everything sent to Dynatrace besides metrics.
+type testRun struct {
+	id              string
+	scriptPath      string
+	maxVUs          uint64
+	plannedDuration time.Duration
+	scenarios       []string
+	startTime       time.Time
+}
+
+func newTestRun(id string, params output.Params) testRun {
+	run := testRun{id: id}
+	if len(run.id) == 0 {
+		run.id = generateTestRunId()
+	}
+	if params.ScriptPath != nil {
+		run.scriptPath = params.ScriptPath.String()
+	}
+	run.maxVUs = lib.GetMaxPlannedVUs(params.ExecutionPlan)
+	run.plannedDuration, _ = lib.GetEndOffset(params.ExecutionPlan)
+	for name := range params.ScriptOptions.Scenarios {
+		run.scenarios = append(run.scenarios, name)
+	}
+	sort.Strings(run.scenarios)
+	return run
+}
+
+func generateTestRunId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// properties returns the test run description as event properties.
+func (run testRun) properties() map[string]string {
+	properties := map[string]string{
+		"k6.test.run.id": run.id,
+		"k6.vus.max":     strconv.FormatUint(run.maxVUs, 10),
+	}
+	if len(run.scriptPath) > 0 {
+		properties["k6.script"] = run.scriptPath
+	}
+	if run.plannedDuration > 0 {
+		properties["k6.duration.planned"] = run.plannedDuration.String()
+	}
+	if len(run.scenarios) > 0 {
+		properties["k6.scenarios"] = strings.Join(run.scenarios, ",")
+	}
+	return properties
+}
+
+// testStartEvent is sent when the output starts.
+func (o *Output) testStartEvent() dynatraceEvent {
+	properties := o.testRun.properties()
+	properties["k6.run.status"] = string(runStatusRunning)
+	return dynatraceEvent{
+		EventType:      o.config.EventType.String,
+		Title:          fmt.Sprintf("k6 load test %s started", o.testRun.id),
+		StartTime:      o.testRun.startTime.UnixMilli(),
+		EntitySelector: o.config.EventEntitySelector.String,
+		Properties:     properties,
+	}
+}
+
+// testEndEvent is sent when the output stops and covers the whole test run.
+func (o *Output) testEndEvent(end time.Time, status runStatus) dynatraceEvent {
+	properties := o.testRun.properties()
+	properties["k6.duration"] = end.Sub(o.testRun.startTime).Round(time.Millisecond).String()
+	properties["k6.run.status"] = string(status)
+	title := fmt.Sprintf("k6 load test %s finished", o.testRun.id)
+	if status != runStatusFinished {
+		title = fmt.Sprintf("k6 load test %s stopped: %s", o.testRun.id, strings.ReplaceAll(string(status), "_", " "))
+	}
+	return dynatraceEvent{
+		EventType:      o.config.EventType.String,
+		Title:          title,
+		StartTime:      o.testRun.startTime.UnixMilli(),
+		EndTime:        end.UnixMilli(),
+		EntitySelector: o.config.EventEntitySelector.String,
+		Properties:     properties,
+	}
+}
+
+// sendEvent posts an event to the Events API v2.
+func (o *Output) sendEvent(event dynatraceEvent) error {
+	eventsUrl, err := o.config.apiUrl(defaultEventsEndPoint)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	o.logger.Debug("Event to send " + string(body))
+
+	response, err := o.post(eventsUrl, "application/json; charset=utf-8", body)
+	if err != nil {
+		return fmt.Errorf("Failed to send the event %q: %w", event.Title, err)
+	}
+	if response.statusCode >= 300 {
+		return fmt.Errorf("Failed to send the event %q, the Events API responded with %s: %s",
+			event.Title, response.status, string(response.body))
+	}
+	o.logger.Debug("Event response: " + string(response.body))
+	return nil
+}
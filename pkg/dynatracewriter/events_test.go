@@ -0,0 +1,58 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSendTestEvents(t *testing.T) {
+	t.Parallel()
+
+	var received []dynatraceEvent
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/e/abc123/api/v2/events/ingest", r.URL.Path)
+		assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Api-Token token", r.Header.Get("Authorization"))
+		var event dynatraceEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+		w.WriteHeader(http.StatusCreated)
+	}, func(c *Config) {
+		c.Url = null.StringFrom(c.Url.String + "/e/abc123")
+		c.Events = null.BoolFrom(true)
+		c.EventEntitySelector = null.StringFrom(`type(SERVICE),entityName("checkout")`)
+	})
+
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	o.testRun = testRun{id: "run-1", scriptPath: "file:///loadgenerator.js", maxVUs: 70, startTime: start}
+
+	require.NoError(t, o.sendEvent(o.testStartEvent()))
+	require.NoError(t, o.sendEvent(o.testEndEvent(start.Add(10*time.Minute), runStatusFinished)))
+	require.Len(t, received, 2)
+
+	assert.Equal(t, "CUSTOM_INFO", received[0].EventType)
+	assert.Equal(t, "k6 load test run-1 started", received[0].Title)
+	assert.Equal(t, `type(SERVICE),entityName("checkout")`, received[0].EntitySelector)
+	assert.Equal(t, map[string]string{
+		"k6.test.run.id": "run-1",
+		"k6.script":      "file:///loadgenerator.js",
+		"k6.vus.max":     "70",
+		"k6.run.status":  "running",
+	}, received[0].Properties)
+
+	assert.Equal(t, "k6 load test run-1 finished", received[1].Title)
+	assert.Equal(t, start.UnixMilli(), received[1].StartTime)
+	assert.Equal(t, start.Add(10*time.Minute).UnixMilli(), received[1].EndTime)
+	assert.Equal(t, "10m0s", received[1].Properties["k6.duration"])
+	assert.Equal(t, "finished", received[1].Properties["k6.run.status"])
+
+	aborted := o.testEndEvent(start.Add(time.Minute), runStatusAbortedByUser)
+	assert.Equal(t, "k6 load test run-1 stopped: aborted by user", aborted.Title)
+	assert.Equal(t, "aborted_by_user", aborted.Properties["k6.run.status"])
+}
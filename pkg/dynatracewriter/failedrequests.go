@@ -0,0 +1,107 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// failedRequestTags are the request tags copied to the log record of a failed request.
+var failedRequestTags = map[string]string{
+	"url":               "http.url",
+	"method":            "http.method",
+	"status":            "http.status_code",
+	"error_code":        "k6.error_code",
+	"scenario":          "k6.scenario",
+	"group":             "k6.group",
+	"name":              "k6.name",
+	"proto":             "http.flavor",
+	"expected_response": "k6.expected_response",
+}
+
+// isFailedRequest reports whether the tags of a request show it failed, either by the expected
+// response callback of the script or by a status code of 400 or above.
+func isFailedRequest(tags map[string]string) bool {
+	if tags["expected_response"] == "false" {
+		return true
+	}
+	status, err := strconv.Atoi(tags["status"])
+	return err == nil && status >= 400
+}
+
+// failedRequestRecord converts the samples of one HTTP request to a log record,
+// the timings are the values of the http_req_* trends in milliseconds.
+func failedRequestRecord(request metrics.Sample, samples []metrics.Sample, tags map[string]string) map[string]string {
+	record := map[string]string{
+		"timestamp":  request.Time.UTC().Format(time.RFC3339Nano),
+		"severity":   "WARN",
+		"log.source": "k6.http",
+	}
+	for tag, attribute := range failedRequestTags {
+		if v, ok := tags[tag]; ok && len(v) > 0 {
+			record[attribute] = v
+		}
+	}
+	for k, v := range request.Metadata {
+		record["k6."+k] = v
+	}
+	for _, sample := range samples {
+		if sample.Metric.Type == metrics.Trend && strings.HasPrefix(sample.Metric.Name, "http_req_") {
+			record["k6."+sample.Metric.Name] = strconv.FormatFloat(sample.Value, 'f', -1, 64)
+		}
+	}
+
+	content := fmt.Sprintf("%s %s failed with status %s", tags["method"], tags["url"], tags["status"])
+	if len(tags["error_code"]) > 0 {
+		content += ", error code " + tags["error_code"]
+	}
+	record["content"] = content
+	return record
+}
+
+// failedRequestRecords samples the failed HTTP requests of the flush and converts them to log records,
+// at most the configured number per flush.
+func (o *Output) failedRequestRecords(samplesContainers []metrics.SampleContainer) []map[string]string {
+	var (
+		records []map[string]string
+		skipped int
+		limit   = int(o.config.FailedRequestsPerFlush.Int64)
+		rate    = o.config.FailedRequestsSampleRate.Float64
+	)
+	for _, samplesContainer := range samplesContainers {
+		samples := samplesContainer.GetSamples()
+		for _, sample := range samples {
+			if sample.Metric.Name != "http_reqs" {
+				continue
+			}
+			tags := sample.GetTags().Map()
+			if !isFailedRequest(tags) || (rate < 1 && rand.Float64() >= rate) {
+				continue
+			}
+			if len(records) >= limit {
+				skipped++
+				continue
+			}
+			records = append(records, failedRequestRecord(sample, samples, tags))
+		}
+	}
+	if skipped > 0 {
+		warnOnce(o.logger, fmt.Sprintf("More than %d failed requests in one flush, the others are not exported as logs", limit))
+		o.logger.Debug(fmt.Sprintf("Dynatrace: %d failed requests were not exported as logs", skipped))
+	}
+	return records
+}
+
+// exportFailedRequests sends the failed HTTP requests of the flush to the Logs API.
+func (o *Output) exportFailedRequests(samplesContainers []metrics.SampleContainer) {
+	if !o.config.FailedRequests.Bool {
+		return
+	}
+	if err := o.sendLogs(o.failedRequestRecords(samplesContainers)); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the failed requests")
+	}
+}
@@ -0,0 +1,74 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestIsFailedRequest(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isFailedRequest(map[string]string{"status": "503", "expected_response": "true"}))
+	assert.True(t, isFailedRequest(map[string]string{"status": "0", "expected_response": "false"}))
+	assert.True(t, isFailedRequest(map[string]string{"status": "404"}))
+	assert.False(t, isFailedRequest(map[string]string{"status": "200", "expected_response": "true"}))
+	assert.False(t, isFailedRequest(map[string]string{"status": "302"}))
+}
+
+func TestFailedRequestRecords(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	reqs := registry.MustNewMetric("http_reqs", metrics.Counter)
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	waiting := registry.MustNewMetric("http_req_waiting", metrics.Trend, metrics.Time)
+	now := time.Now()
+	request := func(status, expected string) metrics.Samples {
+		tags := registry.RootTagSet().WithTagsFromMap(map[string]string{
+			"url": "https://shop.example.com/checkout", "method": "POST", "status": status,
+			"expected_response": expected, "scenario": "checkout", "group": "::buy",
+		})
+		return metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: tags}, Time: now, Value: 1, Metadata: map[string]string{"trace_id": "abc"}},
+			{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: now, Value: 812.5},
+			{TimeSeries: metrics.TimeSeries{Metric: waiting, Tags: tags}, Time: now, Value: 800},
+		}
+	}
+	containers := []metrics.SampleContainer{
+		request("200", "true"), request("503", "false"), request("200", "true"), request("404", "false"), request("500", "false"),
+	}
+
+	c := NewConfig()
+	c.FailedRequests = null.BoolFrom(true)
+	c.FailedRequestsPerFlush = null.IntFrom(2)
+	o := &Output{config: &c, logger: logrus.New()}
+
+	records := o.failedRequestRecords(containers)
+	require.Len(t, records, 2, "capped per flush")
+	assert.Equal(t, map[string]string{
+		"timestamp":            now.UTC().Format(time.RFC3339Nano),
+		"severity":             "WARN",
+		"log.source":           "k6.http",
+		"content":              "POST https://shop.example.com/checkout failed with status 503",
+		"http.url":             "https://shop.example.com/checkout",
+		"http.method":          "POST",
+		"http.status_code":     "503",
+		"k6.expected_response": "false",
+		"k6.scenario":          "checkout",
+		"k6.group":             "::buy",
+		"k6.trace_id":          "abc",
+		"k6.http_req_duration": "812.5",
+		"k6.http_req_waiting":  "800",
+	}, records[0])
+	assert.Equal(t, "404", records[1]["http.status_code"])
+
+	c.FailedRequestsSampleRate = null.FloatFrom(0.000001)
+	c.FailedRequestsPerFlush = null.IntFrom(100)
+	assert.Less(t, len(o.failedRequestRecords(containers)), 3, "sampled")
+}
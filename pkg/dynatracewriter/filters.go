@@ -0,0 +1,138 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+// metricPattern matches metric names, either a glob like http_req_* or a regular expression between slashes.
+type metricPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (p metricPattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// parseMetricPatterns parses a comma separated list of patterns, e.g. "http_req_*,/^(data_sent|iterations)$/".
+// Commas inside a regular expression are kept.
+func parseMetricPatterns(s string) ([]metricPattern, error) {
+	var (
+		patterns []metricPattern
+		fields   = strings.Split(s, ",")
+	)
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimSpace(fields[i])
+		if len(field) == 0 {
+			continue
+		}
+		if strings.HasPrefix(field, "/") {
+			for (len(field) < 2 || !strings.HasSuffix(field, "/")) && i+1 < len(fields) {
+				i++
+				field += "," + fields[i]
+				field = strings.TrimSpace(field)
+			}
+			if len(field) < 2 || !strings.HasSuffix(field, "/") {
+				return nil, fmt.Errorf("the regular expression %q is not closed with a slash", field)
+			}
+			re, err := regexp.Compile(field[1 : len(field)-1])
+			if err != nil {
+				return nil, fmt.Errorf("the regular expression %q is invalid: %w", field, err)
+			}
+			patterns = append(patterns, metricPattern{re: re})
+			continue
+		}
+		if _, err := path.Match(field, ""); err != nil {
+			return nil, fmt.Errorf("the pattern %q is invalid: %w", field, err)
+		}
+		patterns = append(patterns, metricPattern{glob: field})
+	}
+	return patterns, nil
+}
+
+// parseMetricTypes parses a comma separated list of metric types, e.g. "counter,trend". An empty list allows all types.
+func parseMetricTypes(s string) (map[metrics.MetricType]bool, error) {
+	var types map[metrics.MetricType]bool
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if len(field) == 0 {
+			continue
+		}
+		var t metrics.MetricType
+		if err := t.UnmarshalText([]byte(field)); err != nil {
+			return nil, fmt.Errorf("the metric type %q is invalid, expected counter, gauge, rate or trend", field)
+		}
+		if types == nil {
+			types = make(map[metrics.MetricType]bool)
+		}
+		types[t] = true
+	}
+	return types, nil
+}
+
+// metricFilter decides which k6 metrics are sent. The decision is made once per metric and cached.
+type metricFilter struct {
+	include []metricPattern
+	exclude []metricPattern
+	types   map[metrics.MetricType]bool
+	cache   map[string]bool
+}
+
+func newMetricFilter(conf *Config) (*metricFilter, error) {
+	include, err := parseMetricPatterns(conf.IncludeMetrics.String)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseMetricPatterns(conf.ExcludeMetrics.String)
+	if err != nil {
+		return nil, err
+	}
+	types, err := parseMetricTypes(conf.MetricTypes.String)
+	if err != nil {
+		return nil, err
+	}
+	return &metricFilter{include: include, exclude: exclude, types: types, cache: make(map[string]bool)}, nil
+}
+
+// allows tells if the metric is sent: its type is selected, its name matches one of the include patterns,
+// if there are any, and none of the exclude patterns. A nil filter allows all metrics.
+func (f *metricFilter) allows(metric *metrics.Metric) bool {
+	return f.allowsName(metric.Name, metric.Type)
+}
+
+// allowsName is allows for the metrics of the output itself, which have no k6 metric.
+func (f *metricFilter) allowsName(name string, metricType metrics.MetricType) bool {
+	if f == nil {
+		return true
+	}
+	if allowed, ok := f.cache[name]; ok {
+		return allowed
+	}
+	allowed := f.types == nil || f.types[metricType]
+	if allowed && len(f.include) > 0 {
+		allowed = matchesAny(f.include, name)
+	}
+	if allowed {
+		allowed = !matchesAny(f.exclude, name)
+	}
+	f.cache[name] = allowed
+	return allowed
+}
+
+func matchesAny(patterns []metricPattern, name string) bool {
+	for _, p := range patterns {
+		if p.matches(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseMetricPatterns(t *testing.T) {
+	t.Parallel()
+
+	patterns, err := parseMetricPatterns("http_req_*, /^data_(sent|received)$/, /^vus(_max){0,1}$/")
+	require.NoError(t, err)
+	require.Len(t, patterns, 3)
+	assert.True(t, patterns[0].matches("http_req_duration"))
+	assert.True(t, patterns[1].matches("data_sent"))
+	assert.True(t, patterns[2].matches("vus_max"))
+	assert.False(t, patterns[2].matches("vus_maximum"))
+
+	_, err = parseMetricPatterns("/^http_req_")
+	assert.ErrorContains(t, err, "not closed with a slash")
+	_, err = parseMetricPatterns("/(/")
+	assert.ErrorContains(t, err, "is invalid")
+	_, err = parseMetricTypes("counter,histogram")
+	assert.ErrorContains(t, err, `the metric type "histogram" is invalid`)
+}
+
+func TestMetricFilter(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	tls := registry.MustNewMetric("http_req_tls_handshaking", metrics.Trend, metrics.Time)
+	reqs := registry.MustNewMetric("http_reqs", metrics.Counter)
+	sent := registry.MustNewMetric("data_sent", metrics.Counter, metrics.Data)
+	vus := registry.MustNewMetric("vus", metrics.Gauge)
+
+	testCases := []struct {
+		name    string
+		include string
+		exclude string
+		types   string
+		allowed []*metrics.Metric
+	}{
+		{name: "all", allowed: []*metrics.Metric{duration, tls, reqs, sent, vus}},
+		{name: "include glob", include: "http_req*", allowed: []*metrics.Metric{duration, tls, reqs}},
+		{name: "exclude", exclude: "http_req_tls_handshaking,/^data_/", allowed: []*metrics.Metric{duration, reqs, vus}},
+		{name: "include and exclude", include: "http_*", exclude: "*_tls_*", allowed: []*metrics.Metric{duration, reqs}},
+		{name: "types", types: "counter, Gauge", allowed: []*metrics.Metric{reqs, sent, vus}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewConfig()
+			c.IncludeMetrics = null.StringFrom(tc.include)
+			c.ExcludeMetrics = null.StringFrom(tc.exclude)
+			c.MetricTypes = null.StringFrom(tc.types)
+			filter, err := newMetricFilter(&c)
+			require.NoError(t, err)
+
+			var allowed []*metrics.Metric
+			for _, m := range []*metrics.Metric{duration, tls, reqs, sent, vus} {
+				if filter.allows(m) {
+					allowed = append(allowed, m)
+				}
+			}
+			assert.Equal(t, tc.allowed, allowed)
+			// the second decision comes from the cache
+			assert.Len(t, filter.cache, 5)
+			for _, m := range tc.allowed {
+				assert.True(t, filter.allows(m))
+			}
+		})
+	}
+}
+
+func TestMetricFilterOfDerivedMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.ExcludeMetrics = null.StringFrom("apdex,threshold.*")
+	filter, err := newMetricFilter(&c)
+	require.NoError(t, err)
+	o := &Output{config: &c, metricFilter: filter}
+
+	registry := metrics.NewRegistry()
+	tags := registry.RootTagSet().WithTagsFromMap(map[string]string{"expected_response": "true"})
+	sliMetrics := o.apdexMetrics([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("http_req_duration", metrics.Trend), Tags: tags}, Value: 100},
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("http_req_failed", metrics.Rate), Tags: tags}, Value: 0},
+	}}, time.Now())
+	require.Len(t, sliMetrics, 1)
+	assert.Equal(t, "sli.availability", sliMetrics[0].metricKeyName)
+
+	assert.Empty(t, o.thresholdMetrics([]thresholdResult{{metric: "http_req_duration", threshold: "avg<200", passed: true}}, time.Now()))
+	assert.Len(t, o.runStatusMetrics(runStatusRunning, time.Now()), 1)
+}
@@ -0,0 +1,112 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// HistogramCounts selects what the count of a histogram bucket holds.
+type HistogramCounts string
+
+const (
+	// HistogramCountsCumulative counts the values up to the boundary of the bucket, like Prometheus
+	HistogramCountsCumulative HistogramCounts = "cumulative"
+	// HistogramCountsDelta counts the values between the previous boundary and the boundary of the bucket
+	HistogramCountsDelta HistogramCounts = "delta"
+)
+
+// parseBoundaries parses the ascending bucket boundaries of a metric, e.g. 50,100,250,500,1000.
+func parseBoundaries(s string) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	boundaries := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		b, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("the bucket boundary %q is not a number", field)
+		}
+		if len(boundaries) > 0 && b <= boundaries[len(boundaries)-1] {
+			return nil, fmt.Errorf("the bucket boundaries %q must be ascending", s)
+		}
+		boundaries = append(boundaries, b)
+	}
+	if len(boundaries) == 0 {
+		return nil, fmt.Errorf("no bucket boundaries")
+	}
+	return boundaries, nil
+}
+
+// histogramSeries is a trend with one set of dimensions and the counts of its buckets, the last for +Inf.
+type histogramSeries struct {
+	metric dynatraceMetric
+	counts []float64
+}
+
+// histogramBuckets counts the trend values of the flush in the buckets configured for their metric and
+// returns a count line per bucket of every series with the upper boundary in the le dimension.
+func (o *Output) histogramBuckets(dynatraceMetrics []dynatraceMetric, now time.Time) []dynatraceMetric {
+	boundaries := make(map[string][]float64, len(o.config.HistogramBuckets))
+	for metric, text := range o.config.HistogramBuckets {
+		boundaries[metric], _ = parseBoundaries(text)
+	}
+
+	series := make(map[string]*histogramSeries)
+	var keys []string
+	for _, m := range dynatraceMetrics {
+		metricBoundaries, ok := boundaries[m.metricKeyName]
+		if m.metricType != metrics.Trend || !ok {
+			continue
+		}
+		key := seriesKey(m.metricKeyName, m.metricDimensions)
+		s, ok := series[key]
+		if !ok {
+			s = &histogramSeries{metric: m, counts: make([]float64, len(metricBoundaries)+1)}
+			series[key] = s
+			keys = append(keys, key)
+		}
+		s.counts[sort.SearchFloat64s(metricBoundaries, m.metricValue)]++
+	}
+	sort.Strings(keys)
+
+	cumulative := HistogramCounts(o.config.HistogramCounts.String) != HistogramCountsDelta
+	var bucketMetrics []dynatraceMetric
+	for _, key := range keys {
+		s := series[key]
+		metricBoundaries := boundaries[s.metric.metricKeyName]
+		total := 0.0
+		for i, count := range s.counts {
+			le := math.Inf(1)
+			if i < len(metricBoundaries) {
+				le = metricBoundaries[i]
+			}
+			total += count
+			if cumulative {
+				count = total
+			}
+			dimensions := make(map[string]string, len(s.metric.metricDimensions)+1)
+			for k, v := range s.metric.metricDimensions {
+				dimensions[k] = v
+			}
+			dimensions["le"] = strconv.FormatFloat(le, 'f', -1, 64)
+			bucketMetrics = append(bucketMetrics, dynatraceMetric{
+				metricKeyPrefix:  s.metric.metricKeyPrefix,
+				metricKeyName:    s.metric.metricKeyName + ".bucket",
+				metricDimensions: dimensions,
+				metricValue:      count,
+				metricTimeStamp:  now.UnixMilli(),
+				metricType:       metrics.Counter,
+				countDelta:       true,
+			})
+		}
+	}
+	return bucketMetrics
+}
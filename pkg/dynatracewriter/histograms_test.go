@@ -0,0 +1,61 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseBoundaries(t *testing.T) {
+	t.Parallel()
+
+	boundaries, err := parseBoundaries("50,100, 250,500,1000")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{50, 100, 250, 500, 1000}, boundaries)
+
+	_, err = parseBoundaries("100,50")
+	assert.ErrorContains(t, err, "must be ascending")
+	_, err = parseBoundaries("50,fast")
+	assert.ErrorContains(t, err, `"fast" is not a number`)
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	t.Parallel()
+
+	dimensions := map[string]string{"scenario": "checkout"}
+	var dynatraceMetrics []dynatraceMetric
+	for _, v := range []float64{20, 50, 70, 120, 300, 2000} {
+		dynatraceMetrics = append(dynatraceMetrics,
+			dynatraceMetric{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: v, metricDimensions: dimensions},
+			dynatraceMetric{metricKeyName: "http_req_waiting", metricType: metrics.Trend, metricValue: v, metricDimensions: dimensions},
+		)
+	}
+	now := time.Now()
+
+	c := NewConfig()
+	c.HistogramBuckets = map[string]string{"http_req_duration": "50,100,250"}
+	o := &Output{config: &c}
+
+	counts := func(bucketMetrics []dynatraceMetric) map[string]float64 {
+		byLe := map[string]float64{}
+		for _, m := range bucketMetrics {
+			assert.Equal(t, "http_req_duration.bucket", m.metricKeyName)
+			assert.Equal(t, "checkout", m.metricDimensions["scenario"])
+			byLe[m.metricDimensions["le"]] = m.metricValue
+		}
+		return byLe
+	}
+
+	bucketMetrics := o.histogramBuckets(dynatraceMetrics, now)
+	require.Len(t, bucketMetrics, 4, "only the metrics with buckets, one line per bucket and +Inf")
+	assert.Equal(t, map[string]float64{"50": 2, "100": 3, "250": 4, "+Inf": 6}, counts(bucketMetrics))
+	assert.Equal(t, now.UnixMilli(), bucketMetrics[0].metricTimeStamp)
+	assert.Regexp(t, `^k6\.http_req_duration\.bucket,.* count,delta=2 \d+$`, bucketMetrics[0].toText())
+
+	c.HistogramCounts = null.StringFrom("delta")
+	assert.Equal(t, map[string]float64{"50": 2, "100": 1, "250": 1, "+Inf": 2}, counts(o.histogramBuckets(dynatraceMetrics, now)))
+}
@@ -0,0 +1,275 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// thresholdExpressionPattern matches k6 threshold expressions like p(95)<500 or rate<0.01
+var thresholdExpressionPattern = regexp.MustCompile(
+	`^\s*(count|rate|value|avg|min|max|med|p\(\s*([0-9]+(?:\.[0-9]+)?)\s*\))\s*(>=|<=|===|==|!=|>|<)\s*(-?[0-9]+(?:\.[0-9]+)?(?:[eE][-+]?[0-9]+)?)\s*$`)
+
+// thresholdExpression is a parsed k6 threshold expression: aggregation method, operator and value.
+type thresholdExpression struct {
+	method     string
+	percentile float64
+	operator   string
+	value      float64
+}
+
+func parseThresholdExpression(source string) (thresholdExpression, error) {
+	match := thresholdExpressionPattern.FindStringSubmatch(source)
+	if match == nil {
+		return thresholdExpression{}, fmt.Errorf("unsupported threshold expression %q", source)
+	}
+	expression := thresholdExpression{method: match[1], operator: match[3]}
+	if len(match[2]) > 0 {
+		expression.method = "p"
+		expression.percentile, _ = strconv.ParseFloat(match[2], 64)
+	}
+	expression.value, _ = strconv.ParseFloat(match[4], 64)
+	return expression, nil
+}
+
+func (e thresholdExpression) passes(observed float64) bool {
+	switch e.operator {
+	case ">":
+		return observed > e.value
+	case ">=":
+		return observed >= e.value
+	case "<":
+		return observed < e.value
+	case "<=":
+		return observed <= e.value
+	case "==", "===":
+		return observed == e.value
+	default:
+		return observed != e.value
+	}
+}
+
+// flushAggregate aggregates the samples of one metric within one flush window.
+type flushAggregate struct {
+	metricType metrics.MetricType
+	count      int
+	sum        float64
+	min        float64
+	max        float64
+	last       float64
+	trues      int
+	sketch     *quantileSketch
+}
+
+func (a *flushAggregate) add(sample metrics.Sample) {
+	if a.count == 0 || sample.Value < a.min {
+		a.min = sample.Value
+	}
+	if a.count == 0 || sample.Value > a.max {
+		a.max = sample.Value
+	}
+	a.count++
+	a.sum += sample.Value
+	a.last = sample.Value
+	if sample.Value != 0 {
+		a.trues++
+	}
+	if a.metricType == metrics.Trend {
+		if a.sketch == nil {
+			a.sketch = newQuantileSketch()
+		}
+		a.sketch.add(sample.Value)
+	}
+}
+
+// value returns the aggregate the threshold method refers to, false if it is not available for the metric type.
+func (a *flushAggregate) value(e thresholdExpression, window time.Duration) (float64, bool) {
+	if a.count == 0 {
+		return 0, false
+	}
+	switch a.metricType {
+	case metrics.Counter:
+		switch e.method {
+		case "count":
+			return a.sum, true
+		case "rate":
+			return a.sum / window.Seconds(), window > 0
+		}
+	case metrics.Gauge:
+		if e.method == "value" {
+			return a.last, true
+		}
+	case metrics.Rate:
+		if e.method == "rate" {
+			return float64(a.trues) / float64(a.count), true
+		}
+	case metrics.Trend:
+		switch e.method {
+		case "count":
+			return float64(a.count), true
+		case "avg":
+			return a.sum / float64(a.count), true
+		case "min":
+			return a.min, true
+		case "max":
+			return a.max, true
+		case "med":
+			return a.sketch.quantile(50), true
+		case "p":
+			return a.sketch.quantile(e.percentile), true
+		}
+	}
+	return 0, false
+}
+
+// liveThreshold is one threshold of the script, evaluated on every flush window.
+type liveThreshold struct {
+	metric     string
+	name       string
+	tags       map[string]string
+	source     string
+	expression thresholdExpression
+	failing    bool
+}
+
+// thresholdTransition is a threshold which started or stopped failing in a flush window.
+type thresholdTransition struct {
+	threshold   *liveThreshold
+	failing     bool
+	observed    float64
+	windowStart time.Time
+	windowEnd   time.Time
+}
+
+// thresholdEvaluator evaluates the thresholds of the script on the aggregates of every flush.
+type thresholdEvaluator struct {
+	thresholds []*liveThreshold
+}
+
+// newThresholdEvaluator parses the thresholds, unsupported ones are returned as errors and skipped.
+func newThresholdEvaluator(thresholds map[string]metrics.Thresholds) (*thresholdEvaluator, []error) {
+	evaluator := &thresholdEvaluator{}
+	var errs []error
+	for metric, metricThresholds := range thresholds {
+		name, selectors, err := metrics.ParseMetricName(metric)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tags := make(map[string]string, len(selectors))
+		for _, selector := range selectors {
+			k, v, _ := strings.Cut(selector, ":")
+			tags[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+		for _, threshold := range metricThresholds.Thresholds {
+			expression, err := parseThresholdExpression(threshold.Source)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", metric, err))
+				continue
+			}
+			evaluator.thresholds = append(evaluator.thresholds, &liveThreshold{
+				metric: metric, name: name, tags: tags, source: threshold.Source, expression: expression,
+			})
+		}
+	}
+	sort.Slice(evaluator.thresholds, func(i, j int) bool {
+		a, b := evaluator.thresholds[i], evaluator.thresholds[j]
+		return a.metric < b.metric || (a.metric == b.metric && a.source < b.source)
+	})
+	return evaluator, errs
+}
+
+func (l *liveThreshold) matches(sample metrics.Sample) bool {
+	if sample.Metric.Name != l.name {
+		return false
+	}
+	if len(l.tags) == 0 {
+		return true
+	}
+	sampleTags := sample.GetTags().Map()
+	for k, v := range l.tags {
+		if sampleTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate aggregates the samples of the flush window and returns the thresholds whose status changed.
+// Thresholds without samples in the window keep their status.
+func (e *thresholdEvaluator) evaluate(samplesContainers []metrics.SampleContainer, windowStart, windowEnd time.Time) []thresholdTransition {
+	aggregates := make([]*flushAggregate, len(e.thresholds))
+	for _, samplesContainer := range samplesContainers {
+		for _, sample := range samplesContainer.GetSamples() {
+			for i, threshold := range e.thresholds {
+				if !threshold.matches(sample) {
+					continue
+				}
+				if aggregates[i] == nil {
+					aggregates[i] = &flushAggregate{metricType: sample.Metric.Type}
+				}
+				aggregates[i].add(sample)
+			}
+		}
+	}
+
+	var transitions []thresholdTransition
+	for i, threshold := range e.thresholds {
+		if aggregates[i] == nil {
+			continue
+		}
+		observed, ok := aggregates[i].value(threshold.expression, windowEnd.Sub(windowStart))
+		if !ok {
+			continue
+		}
+		failing := !threshold.expression.passes(observed)
+		if failing != threshold.failing {
+			threshold.failing = failing
+			transitions = append(transitions, thresholdTransition{
+				threshold: threshold, failing: failing, observed: observed, windowStart: windowStart, windowEnd: windowEnd,
+			})
+		}
+	}
+	return transitions
+}
+
+// thresholdTransitionEvent describes a threshold which started or stopped failing.
+func (o *Output) thresholdTransitionEvent(transition thresholdTransition) dynatraceEvent {
+	state := "stopped failing"
+	if transition.failing {
+		state = "started failing"
+	}
+	properties := o.testRun.properties()
+	properties["k6.threshold.metric"] = transition.threshold.metric
+	properties["k6.threshold"] = transition.threshold.source
+	properties["k6.threshold.observed"] = strconv.FormatFloat(transition.observed, 'g', -1, 64)
+	properties["k6.window.start"] = transition.windowStart.UTC().Format(time.RFC3339Nano)
+	properties["k6.window.end"] = transition.windowEnd.UTC().Format(time.RFC3339Nano)
+	return dynatraceEvent{
+		EventType:      o.config.EventType.String,
+		Title:          fmt.Sprintf("k6 threshold %s on %s %s", transition.threshold.source, transition.threshold.metric, state),
+		StartTime:      transition.windowStart.UnixMilli(),
+		EndTime:        transition.windowEnd.UnixMilli(),
+		EntitySelector: o.config.EventEntitySelector.String,
+		Properties:     properties,
+	}
+}
+
+// evaluateLiveThresholds posts an event for every threshold which started or stopped failing in the flush window.
+func (o *Output) evaluateLiveThresholds(samplesContainers []metrics.SampleContainer, windowEnd time.Time) {
+	if o.liveThresholds == nil {
+		return
+	}
+	windowStart := o.lastFlush
+	o.lastFlush = windowEnd
+	for _, transition := range o.liveThresholds.evaluate(samplesContainers, windowStart, windowEnd) {
+		if err := o.sendEvent(o.thresholdTransitionEvent(transition)); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the threshold event")
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLogsEndPoint = "/api/v2/logs/ingest"
+	defaultLogLevel     = "info"
+	// maxLogRecordsPerRequest keeps the requests well below the limits of the Logs API
+	maxLogRecordsPerRequest = 1000
+	// maxBufferedLogRecords bounds the memory used when the logs can not be sent, newer entries are dropped
+	maxBufferedLogRecords = 10000
+	// ownLogPrefix starts the messages of the output itself, they are not shipped
+	ownLogPrefix = "Dynatrace:"
+)
+
+// logLevels are the levels which can be shipped. Debug and trace are excluded, they include the
+// payloads the output sends and would ship every batch of logs again with the next one.
+var logLevels = []string{"panic", "fatal", "error", "warning", "info"}
+
+// logShipper is a logrus hook which buffers the log entries of k6 and the script until the next flush.
+// The entries of the output itself are left out, a failure to send would otherwise be sent with the next batch.
+type logShipper struct {
+	levels []logrus.Level
+	// logger has the hook installed, its hooks from before are restored on close
+	logger        *logrus.Logger
+	previousHooks logrus.LevelHooks
+
+	mu      sync.Mutex
+	records []map[string]string
+	dropped int
+	closed  bool
+}
+
+func newLogShipper(level string) (*logShipper, error) {
+	minLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	shipper := &logShipper{}
+	for _, l := range logrus.AllLevels {
+		if l <= minLevel && l <= logrus.InfoLevel {
+			shipper.levels = append(shipper.levels, l)
+		}
+	}
+	return shipper, nil
+}
+
+// Levels implements logrus.Hook.
+func (s *logShipper) Levels() []logrus.Level {
+	return s.levels
+}
+
+// Fire implements logrus.Hook. It only buffers the entry, logging from here would call the hook again.
+func (s *logShipper) Fire(entry *logrus.Entry) error {
+	if strings.HasPrefix(entry.Message, ownLogPrefix) {
+		return nil
+	}
+	record := map[string]string{
+		"content":   entry.Message,
+		"timestamp": entry.Time.UTC().Format(time.RFC3339Nano),
+		"severity":  strings.ToUpper(entry.Level.String()),
+	}
+	for k, v := range entry.Data {
+		if _, reserved := record[k]; !reserved {
+			record[k] = fmt.Sprint(v)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if len(s.records) >= maxBufferedLogRecords {
+		s.dropped++
+		return nil
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+// drain returns the buffered records and how many were dropped since the last drain.
+func (s *logShipper) drain() ([]map[string]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, dropped := s.records, s.dropped
+	s.records, s.dropped = nil, 0
+	return records, dropped
+}
+
+// close stops buffering and removes the hook from the logger, entries logged after the final flush are not shipped.
+func (s *logShipper) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	if s.logger != nil {
+		s.logger.ReplaceHooks(s.previousHooks)
+	}
+}
+
+// startLogShipping installs the log hook on the logger of k6, keeping its other hooks to restore them at the end.
+func (o *Output) startLogShipping() error {
+	var logger *logrus.Logger
+	switch l := o.logger.(type) {
+	case *logrus.Logger:
+		logger = l
+	case *logrus.Entry:
+		logger = l.Logger
+	default:
+		return fmt.Errorf("the k6 logger %T does not support hooks", o.logger)
+	}
+	shipper, err := newLogShipper(o.config.LogLevel.String)
+	if err != nil {
+		return err
+	}
+	hooks := make(logrus.LevelHooks, len(logger.Hooks))
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	hooks.Add(shipper)
+	shipper.logger = logger
+	shipper.previousHooks = logger.ReplaceHooks(hooks)
+	o.logShipper = shipper
+	return nil
+}
+
+// flushLogs sends the buffered log entries with the test run and the configured dimensions as attributes.
+func (o *Output) flushLogs() {
+	if o.logShipper == nil {
+		return
+	}
+	records, dropped := o.logShipper.drain()
+	if dropped > 0 {
+		o.logger.Warn(fmt.Sprintf("Dynatrace: %d log entries were dropped, the logs could not be sent fast enough", dropped))
+	}
+	if err := o.sendLogs(records); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the logs")
+	}
+}
+
+// sendLogs posts log records to the Logs API v2, split into several requests if needed.
+func (o *Output) sendLogs(records []map[string]string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	logsUrl, err := o.config.apiUrl(defaultLogsEndPoint)
+	if err != nil {
+		return err
+	}
+	attributes := o.testRun.properties()
+	for k, v := range o.config.Dimensions {
+		attributes[k] = v
+	}
+	for _, record := range records {
+		for k, v := range attributes {
+			if _, defined := record[k]; !defined {
+				record[k] = v
+			}
+		}
+	}
+
+	for start := 0; start < len(records); start += maxLogRecordsPerRequest {
+		end := start + maxLogRecordsPerRequest
+		if end > len(records) {
+			end = len(records)
+		}
+		body, err := json.Marshal(records[start:end])
+		if err != nil {
+			return err
+		}
+		response, err := o.post(logsUrl, "application/json; charset=utf-8", body)
+		if err != nil {
+			return err
+		}
+		if response.statusCode >= 300 {
+			return fmt.Errorf("the Logs API responded with %s: %s", response.status, string(response.body))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestShipLogs(t *testing.T) {
+	t.Parallel()
+
+	var received []map[string]string
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/logs/ingest", r.URL.Path)
+		assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Api-Token token", r.Header.Get("Authorization"))
+		var records []map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+		received = append(received, records...)
+		w.WriteHeader(http.StatusNoContent)
+	}, func(c *Config) {
+		c.Logs = null.BoolFrom(true)
+		c.Dimensions = map[string]string{"test": "checkout"}
+	})
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	o.logger = logger
+	o.testRun = testRun{id: "run-1", scriptPath: "file:///loadgenerator.js"}
+	require.NoError(t, o.startLogShipping())
+
+	logger.WithField("source", "console").Info("checkout started")
+	logger.Debug("not shipped below the log level")
+	logger.WithField("severity", "reserved").Error("request failed")
+	logger.Warn("Dynatrace: failed to send the logs")
+	o.flushLogs()
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "checkout started", received[0]["content"])
+	assert.Equal(t, "INFO", received[0]["severity"])
+	assert.Equal(t, "console", received[0]["source"])
+	assert.Equal(t, "run-1", received[0]["k6.test.run.id"])
+	assert.Equal(t, "file:///loadgenerator.js", received[0]["k6.script"])
+	assert.Equal(t, "checkout", received[0]["test"])
+	assert.NotEmpty(t, received[0]["timestamp"])
+	assert.Equal(t, "ERROR", received[1]["severity"])
+
+	o.logShipper.close()
+	assert.Empty(t, logger.Hooks, "the hook is removed at the end of the test")
+	logger.Info("after the test")
+	o.flushLogs()
+	assert.Len(t, received, 2)
+}
+
+func TestLogShippingRestoresHooks(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {}, func(c *Config) {
+		c.Logs = null.BoolFrom(true)
+	})
+	logger := logrus.New()
+	logger.Out = io.Discard
+	other, err := newLogShipper("error")
+	require.NoError(t, err)
+	logger.AddHook(other)
+	o.logger = logger.WithField("output", "dynatrace")
+
+	require.NoError(t, o.startLogShipping())
+	assert.Len(t, logger.Hooks[logrus.InfoLevel], 1)
+	assert.Len(t, logger.Hooks[logrus.ErrorLevel], 2)
+	o.logShipper.close()
+	assert.Equal(t, logrus.LevelHooks{
+		logrus.PanicLevel: {other}, logrus.FatalLevel: {other}, logrus.ErrorLevel: {other},
+	}, logger.Hooks)
+}
+
+func TestLogShipperBufferLimit(t *testing.T) {
+	t.Parallel()
+
+	shipper, err := newLogShipper("info")
+	require.NoError(t, err)
+	logger := logrus.New()
+	logger.AddHook(shipper)
+	logger.Out = io.Discard
+	for i := 0; i < maxBufferedLogRecords+5; i++ {
+		logger.Info("entry")
+	}
+
+	records, dropped := shipper.drain()
+	assert.Len(t, records, maxBufferedLogRecords)
+	assert.Equal(t, 5, dropped)
+	records, dropped = shipper.drain()
+	assert.Empty(t, records)
+	assert.Zero(t, dropped)
+}
@@ -0,0 +1,147 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protocol selects how the metrics are encoded and which ingest endpoint receives them.
+type Protocol string
+
+const (
+	// ProtocolLine sends the metrics in the Dynatrace line protocol to the metrics ingest API
+	ProtocolLine Protocol = "line"
+	// ProtocolOTLP sends the metrics as OTLP/HTTP protobuf to the OpenTelemetry ingest API
+	ProtocolOTLP Protocol = "otlp"
+)
+
+const (
+	defaultOtlpMetricEndPoint         = "/api/v2/otlp/v1/metrics"
+	defaultOneAgentOtlpMetricEndPoint = "/otlp/v1/metrics"
+	otlpScopeName                     = "xk6-output-dynatrace"
+)
+
+// ParseProtocol converts the configured value to a Protocol, an empty value means the line protocol.
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ProtocolLine, nil
+	case ProtocolLine, ProtocolOTLP:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown metrics protocol %q, expected %s or %s", s, ProtocolLine, ProtocolOTLP)
+	}
+}
+
+func (p Protocol) contentType() string {
+	if p == ProtocolOTLP {
+		return "application/x-protobuf"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// otlpResource describes the test run as resource of all the metrics.
+func (o *Output) otlpResource() *resourcepb.Resource {
+	attributes := map[string]string{"service.name": "k6"}
+	for k, v := range o.testRun.properties() {
+		attributes[k] = v
+	}
+	return &resourcepb.Resource{Attributes: otlpAttributes(attributes)}
+}
+
+// otlpAttributes converts dimensions to OTLP attributes, sorted by key for a stable payload.
+func otlpAttributes(dimensions map[string]string) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(dimensions))
+	for k, v := range dimensions {
+		if len(k) == 0 || len(v) == 0 {
+			continue
+		}
+		attributes = append(attributes, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}},
+		})
+	}
+	sortAttributes(attributes)
+	return attributes
+}
+
+func sortAttributes(attributes []*commonpb.KeyValue) {
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Key < attributes[j].Key })
+}
+
+// otlpMetricsPayload encodes the metrics as OTLP. Counters become monotonic delta sums, trends
+// single sample delta histograms, gauges and rates gauges, as Dynatrace only ingests delta temporality.
+func (o *Output) otlpMetricsPayload(dynatraceMetrics []dynatraceMetric) ([]byte, error) {
+	var (
+		otlpMetrics []*metricpb.Metric
+		byName      = make(map[string]*metricpb.Metric)
+	)
+	for _, m := range dynatraceMetrics {
+		prefix := m.metricKeyPrefix
+		if len(prefix) == 0 {
+			prefix = metricKeyPrefix
+		}
+		name := prefix + "." + m.metricKeyName
+		timestamp := uint64(m.metricTimeStamp) * 1e6
+		attributes := otlpAttributes(m.metricDimensions)
+
+		otlpMetric, ok := byName[name]
+		if !ok {
+			otlpMetric = &metricpb.Metric{Name: name, Description: m.description, Unit: m.metricUnit}
+			switch m.metricType {
+			case metrics.Counter:
+				otlpMetric.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+					AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					IsMonotonic:            true,
+				}}
+			case metrics.Trend:
+				otlpMetric.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+					AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				}}
+			default:
+				otlpMetric.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}
+			}
+			byName[name] = otlpMetric
+			otlpMetrics = append(otlpMetrics, otlpMetric)
+		}
+
+		switch data := otlpMetric.Data.(type) {
+		case *metricpb.Metric_Sum:
+			data.Sum.DataPoints = append(data.Sum.DataPoints, &metricpb.NumberDataPoint{
+				Attributes: attributes, StartTimeUnixNano: timestamp, TimeUnixNano: timestamp,
+				Value: &metricpb.NumberDataPoint_AsDouble{AsDouble: m.metricValue},
+			})
+		case *metricpb.Metric_Histogram:
+			summary := gaugeSummary{min: m.metricValue, max: m.metricValue, sum: m.metricValue, count: 1}
+			if m.metricSummary != nil {
+				summary = *m.metricSummary
+			}
+			data.Histogram.DataPoints = append(data.Histogram.DataPoints, &metricpb.HistogramDataPoint{
+				Attributes: attributes, StartTimeUnixNano: timestamp, TimeUnixNano: timestamp,
+				Count: uint64(summary.count), Sum: &summary.sum, Min: &summary.min, Max: &summary.max,
+				BucketCounts: []uint64{uint64(summary.count)},
+			})
+		case *metricpb.Metric_Gauge:
+			data.Gauge.DataPoints = append(data.Gauge.DataPoints, &metricpb.NumberDataPoint{
+				Attributes: attributes, TimeUnixNano: timestamp,
+				Value: &metricpb.NumberDataPoint_AsDouble{AsDouble: m.metricValue},
+			})
+		}
+	}
+
+	// MetricsData has the same wire format as the ExportMetricsServiceRequest the endpoint expects
+	return proto.Marshal(&metricpb.MetricsData{ResourceMetrics: []*metricpb.ResourceMetrics{{
+		Resource: o.otlpResource(),
+		ScopeMetrics: []*metricpb.ScopeMetrics{{
+			Scope:   &commonpb.InstrumentationScope{Name: otlpScopeName},
+			Metrics: otlpMetrics,
+		}},
+	}}})
+}
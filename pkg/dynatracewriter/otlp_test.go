@@ -0,0 +1,70 @@
+package dynatracewriter
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSendMetricsOtlp(t *testing.T) {
+	t.Parallel()
+
+	var received metricpb.MetricsData
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/otlp/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(body, &received))
+	}, func(c *Config) {
+		c.Protocol = null.StringFrom("otlp")
+	})
+	o.testRun = testRun{id: "run-1"}
+
+	dimensions := map[string]string{"scenario": "checkout"}
+	require.NoError(t, o.sendMetrics([]dynatraceMetric{
+		{metricKeyName: "http_reqs", metricType: metrics.Counter, metricValue: 1, metricTimeStamp: 1000, metricDimensions: dimensions},
+		{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: 120.5, metricTimeStamp: 1000, metricDimensions: dimensions},
+		{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: 80, metricTimeStamp: 2000, metricDimensions: dimensions},
+		{metricKeyName: "vus", metricType: metrics.Gauge, metricValue: 10, metricTimeStamp: 1000},
+		{metricKeyName: "checks", metricType: metrics.Rate, metricValue: 1, metricTimeStamp: 1000},
+	}))
+
+	require.Len(t, received.ResourceMetrics, 1)
+	resource := map[string]string{}
+	for _, attribute := range received.ResourceMetrics[0].Resource.Attributes {
+		resource[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	assert.Equal(t, "k6", resource["service.name"])
+	assert.Equal(t, "run-1", resource["k6.test.run.id"])
+
+	otlpMetrics := received.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, otlpMetrics, 4)
+
+	assert.Equal(t, "k6.http_reqs", otlpMetrics[0].Name)
+	sum := otlpMetrics[0].GetSum()
+	require.NotNil(t, sum)
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+	assert.Equal(t, 1.0, sum.DataPoints[0].GetAsDouble())
+	assert.Equal(t, uint64(1000)*1e6, sum.DataPoints[0].TimeUnixNano)
+	assert.Equal(t, "scenario", sum.DataPoints[0].Attributes[0].Key)
+
+	histogram := otlpMetrics[1].GetHistogram()
+	require.NotNil(t, histogram)
+	require.Len(t, histogram.DataPoints, 2)
+	assert.Equal(t, uint64(1), histogram.DataPoints[0].Count)
+	assert.Equal(t, 120.5, histogram.DataPoints[0].GetSum())
+	assert.Equal(t, 80.0, histogram.DataPoints[1].GetMax())
+
+	assert.Equal(t, 10.0, otlpMetrics[2].GetGauge().DataPoints[0].GetAsDouble())
+	assert.Equal(t, "k6.checks", otlpMetrics[3].Name)
+	assert.NotNil(t, otlpMetrics[3].GetGauge())
+}
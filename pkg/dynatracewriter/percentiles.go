@@ -0,0 +1,108 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// PercentileFormat selects how the percentiles of a trend are sent.
+type PercentileFormat string
+
+const (
+	// PercentileFormatKey sends every percentile as its own metric, e.g. k6.http_req_duration.p95
+	PercentileFormatKey PercentileFormat = "key"
+	// PercentileFormatDimension sends all percentiles as k6.http_req_duration.percentile with a percentile dimension
+	PercentileFormatDimension PercentileFormat = "dimension"
+)
+
+const defaultPercentiles = "90,95,99"
+
+// parsePercentiles parses a comma separated list of percentiles like 90,95,99.9.
+func parsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimPrefix(strings.TrimSpace(field), "p")
+		if len(field) == 0 {
+			continue
+		}
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("the percentile %q is invalid, it must be a number greater than 0 and less than 100", field)
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+// seriesKey identifies a metric with one set of dimensions.
+func seriesKey(name string, dimensions map[string]string) string {
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "=" + dimensions[k])
+	}
+	return b.String()
+}
+
+// trendSeries is a trend with one set of dimensions and the sketch of its values.
+type trendSeries struct {
+	metric dynatraceMetric
+	sketch *quantileSketch
+}
+
+// trendPercentiles computes the configured percentiles of every trend and dimension set of the flush.
+func (o *Output) trendPercentiles(dynatraceMetrics []dynatraceMetric, now time.Time) []dynatraceMetric {
+	percentiles, _ := parsePercentiles(o.config.Percentiles.String)
+	series := make(map[string]*trendSeries)
+	var keys []string
+	for _, m := range dynatraceMetrics {
+		if m.metricType != metrics.Trend {
+			continue
+		}
+		key := seriesKey(m.metricKeyName, m.metricDimensions)
+		s, ok := series[key]
+		if !ok {
+			s = &trendSeries{metric: m, sketch: newQuantileSketch()}
+			series[key] = s
+			keys = append(keys, key)
+		}
+		s.sketch.add(m.metricValue)
+	}
+	sort.Strings(keys)
+
+	var percentileMetrics []dynatraceMetric
+	for _, key := range keys {
+		s := series[key]
+		for _, p := range percentiles {
+			label := "p" + strconv.FormatFloat(p, 'f', -1, 64)
+			m := dynatraceMetric{
+				metricKeyPrefix:  s.metric.metricKeyPrefix,
+				metricKeyName:    s.metric.metricKeyName + "." + label,
+				metricDimensions: s.metric.metricDimensions,
+				metricValue:      s.sketch.quantile(p),
+				metricTimeStamp:  now.UnixMilli(),
+				metricType:       metrics.Gauge,
+			}
+			if PercentileFormat(o.config.PercentileFormat.String) == PercentileFormatDimension {
+				m.metricKeyName = s.metric.metricKeyName + ".percentile"
+				m.metricDimensions = make(map[string]string, len(s.metric.metricDimensions)+1)
+				for k, v := range s.metric.metricDimensions {
+					m.metricDimensions[k] = v
+				}
+				m.metricDimensions["percentile"] = label
+			}
+			percentileMetrics = append(percentileMetrics, m)
+		}
+	}
+	return percentileMetrics
+}
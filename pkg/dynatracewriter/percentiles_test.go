@@ -0,0 +1,113 @@
+package dynatracewriter
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+// percentile interpolates the exact p-th percentile of values like k6 does for its end of test summary.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	if len(values) == 1 || p <= 0 {
+		return values[0]
+	}
+	if p >= 100 {
+		return values[len(values)-1]
+	}
+	position := p / 100 * float64(len(values)-1)
+	lower := math.Floor(position)
+	i := int(lower)
+	return values[i] + (values[i+1]-values[i])*(position-lower)
+}
+
+func TestQuantileSketch(t *testing.T) {
+	t.Parallel()
+
+	sketch := newQuantileSketch()
+	values := make([]float64, 0, 100000)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		v := random.ExpFloat64() * 200
+		values = append(values, v)
+		sketch.add(v)
+	}
+	sketch.add(0)
+	values = append(values, 0)
+
+	for _, p := range []float64{50, 90, 95, 99, 99.9} {
+		exact := percentile(values, p)
+		assert.InEpsilon(t, exact, sketch.quantile(p), 0.02, "p%g", p)
+	}
+	assert.Equal(t, 0.0, sketch.quantile(0))
+	assert.Equal(t, values[len(values)-1], sketch.quantile(100))
+	assert.LessOrEqual(t, len(sketch.buckets), sketchMaxBuckets)
+}
+
+func TestQuantileSketchBoundedMemory(t *testing.T) {
+	t.Parallel()
+
+	sketch := newQuantileSketch()
+	for v := 1e-9; v < 1e12; v *= 1.001 {
+		sketch.add(v)
+	}
+	assert.Len(t, sketch.buckets, sketchMaxBuckets)
+	assert.InEpsilon(t, 1e12, sketch.quantile(99.99), 0.05)
+}
+
+func TestParsePercentiles(t *testing.T) {
+	t.Parallel()
+
+	percentiles, err := parsePercentiles("90, p95,99.9")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{90, 95, 99.9}, percentiles)
+
+	_, err = parsePercentiles("95,100")
+	assert.ErrorContains(t, err, `the percentile "100" is invalid`)
+}
+
+func TestTrendPercentiles(t *testing.T) {
+	t.Parallel()
+
+	var dynatraceMetrics []dynatraceMetric
+	for i := 1; i <= 100; i++ {
+		dynatraceMetrics = append(dynatraceMetrics,
+			dynatraceMetric{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: float64(i),
+				metricDimensions: map[string]string{"status": "200"}},
+			dynatraceMetric{metricKeyName: "http_req_duration", metricType: metrics.Trend, metricValue: float64(1000 + i),
+				metricDimensions: map[string]string{"status": "500"}},
+			dynatraceMetric{metricKeyName: "vus", metricType: metrics.Gauge, metricValue: 10},
+		)
+	}
+	now := time.Now()
+
+	c := NewConfig()
+	c.TrendPercentiles = null.BoolFrom(true)
+	c.Percentiles = null.StringFrom("50,95")
+	o := &Output{config: &c}
+
+	percentileMetrics := o.trendPercentiles(dynatraceMetrics, now)
+	require.Len(t, percentileMetrics, 4)
+	assert.Equal(t, "http_req_duration.p50", percentileMetrics[0].metricKeyName)
+	assert.Equal(t, map[string]string{"status": "200"}, percentileMetrics[0].metricDimensions)
+	assert.InEpsilon(t, 50, percentileMetrics[0].metricValue, 0.01)
+	assert.Equal(t, "http_req_duration.p95", percentileMetrics[1].metricKeyName)
+	assert.InEpsilon(t, 95, percentileMetrics[1].metricValue, 0.01)
+	assert.Equal(t, map[string]string{"status": "500"}, percentileMetrics[3].metricDimensions)
+	assert.InEpsilon(t, 1095, percentileMetrics[3].metricValue, 0.01)
+	assert.Equal(t, now.UnixMilli(), percentileMetrics[3].metricTimeStamp)
+
+	c.PercentileFormat = null.StringFrom("dimension")
+	percentileMetrics = o.trendPercentiles(dynatraceMetrics, now)
+	require.Len(t, percentileMetrics, 4)
+	assert.Equal(t, "http_req_duration.percentile", percentileMetrics[1].metricKeyName)
+	assert.Equal(t, map[string]string{"status": "200", "percentile": "p95"}, percentileMetrics[1].metricDimensions)
+	assert.Contains(t, percentileMetrics[1].toText(), `k6.http_req_duration.percentile,`)
+}
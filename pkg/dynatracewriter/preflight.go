@@ -0,0 +1,53 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// preflight sends an empty payload to the metrics ingest endpoint before the test starts,
+// so that a wrong URL or a token without the ingest scope fails the run right away
+// instead of showing up as debug-level response bodies during the test.
+//
+// Dynatrace authenticates the request before it looks at the payload, so an empty payload
+// is rejected with 400 only when the URL and the token are fine.
+func (o *Output) preflight() error {
+	request, err := o.newRequest(o.config.Url.String, "", nil)
+	if err != nil {
+		return fmt.Errorf("Dynatrace preflight check failed: %w", err)
+	}
+
+	response, err := o.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Dynatrace preflight check failed, %s can not be reached: %w. Check the Dynatrace URL", o.config.Url.String, err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	o.logger.Debug("Dynatrace: preflight response " + response.Status + " " + string(body))
+
+	switch {
+	case response.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("Dynatrace preflight check failed with %s: the %s credentials are invalid or expired",
+			response.Status, o.config.AuthType.String)
+	case response.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("Dynatrace preflight check failed with %s: the credentials are missing the %s scope",
+			response.Status, o.requiredScope())
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusMethodNotAllowed:
+		return fmt.Errorf("Dynatrace preflight check failed with %s: %s is not a metrics ingest endpoint. "+
+			"Check the Dynatrace URL and the endpoint mode (%s)", response.Status, o.config.Url.String, o.config.EndpointMode.String)
+	case response.StatusCode >= 500:
+		return fmt.Errorf("Dynatrace preflight check failed with %s: %s", response.Status, string(body))
+	}
+
+	o.logger.Debug("Dynatrace: preflight check passed")
+	return nil
+}
+
+// requiredScope names the scope needed to ingest metrics with the configured auth type.
+func (o *Output) requiredScope() string {
+	if AuthType(o.config.AuthType.String) == AuthTypeOAuth2 {
+		return "storage:metrics:write"
+	}
+	return "metrics.ingest (Ingest metrics)"
+}
@@ -0,0 +1,46 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status    int
+		errString string
+	}{
+		"empty_payload_rejected": {status: http.StatusBadRequest},
+		"accepted":               {status: http.StatusAccepted},
+		"invalid_token":          {status: http.StatusUnauthorized, errString: "invalid or expired"},
+		"missing_scope":          {status: http.StatusForbidden, errString: "metrics.ingest"},
+		"wrong_path":             {status: http.StatusNotFound, errString: "is not a metrics ingest endpoint"},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v2/metrics/ingest", r.URL.Path)
+				assert.Equal(t, "Api-Token token", r.Header.Get("Authorization"))
+				w.WriteHeader(testCase.status)
+			}, func(c *Config) {
+				c.EndpointMode = null.StringFrom("saas")
+			})
+
+			err := o.preflight()
+			if len(testCase.errString) > 0 {
+				assert.ErrorContains(t, err, testCase.errString)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
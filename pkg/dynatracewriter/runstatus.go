@@ -0,0 +1,102 @@
+package dynatracewriter
+
+import (
+	"errors"
+	"time"
+
+	"go.k6.io/k6/errext"
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+)
+
+const runStatusMetric = "run.status"
+
+var _ output.WithStopWithTestError = new(Output)
+
+// runStatus is the state of the test run as it is reported to Dynatrace.
+type runStatus string
+
+const (
+	runStatusRunning              runStatus = "running"
+	runStatusFinished             runStatus = "finished"
+	runStatusAbortedByUser        runStatus = "aborted_by_user"
+	runStatusAbortedByThreshold   runStatus = "aborted_by_threshold"
+	runStatusAbortedByScriptError runStatus = "aborted_by_script_error"
+	runStatusAbortedByScript      runStatus = "aborted_by_script"
+	runStatusAbortedByTimeout     runStatus = "aborted_by_timeout"
+	runStatusAbortedByOutput      runStatus = "aborted_by_output"
+	runStatusFailed               runStatus = "failed"
+)
+
+// runStatusFromError derives the final status of the test run from the error it finished with.
+func runStatusFromError(testRunErr error) runStatus {
+	if testRunErr == nil {
+		return runStatusFinished
+	}
+	var withReason errext.HasAbortReason
+	if !errors.As(testRunErr, &withReason) {
+		return runStatusFailed
+	}
+	switch withReason.AbortReason() {
+	case errext.AbortedByUser:
+		return runStatusAbortedByUser
+	case errext.AbortedByThreshold, errext.AbortedByThresholdsAfterTestEnd:
+		return runStatusAbortedByThreshold
+	case errext.AbortedByScriptError:
+		return runStatusAbortedByScriptError
+	case errext.AbortedByScriptAbort:
+		return runStatusAbortedByScript
+	case errext.AbortedByTimeout:
+		return runStatusAbortedByTimeout
+	case errext.AbortedByOutput:
+		return runStatusAbortedByOutput
+	default:
+		return runStatusFailed
+	}
+}
+
+// runStatusMetrics converts a status transition to a k6.run.status gauge of 1 with the status as dimension.
+// It is subject to the metric filter like the k6 metrics.
+func (o *Output) runStatusMetrics(status runStatus, now time.Time) []dynatraceMetric {
+	if !o.metricFilter.allowsName(runStatusMetric, metrics.Gauge) {
+		return nil
+	}
+	dimensions := make(map[string]string, len(o.config.Dimensions)+1)
+	for k, v := range o.config.Dimensions {
+		dimensions[k] = v
+	}
+	dimensions["status"] = string(status)
+	return []dynatraceMetric{{
+		metricKeyPrefix:  o.config.MetricPrefix.String,
+		metricKeyName:    runStatusMetric,
+		metricDimensions: dimensions,
+		metricValue:      1,
+		metricTimeStamp:  now.UnixMilli(),
+		metricType:       metrics.Gauge,
+	}}
+}
+
+// queueRunStatus keeps a status transition to be sent with the metrics of the next flush,
+// so the start of the test is not held up by a request to Dynatrace.
+func (o *Output) queueRunStatus(status runStatus, now time.Time) {
+	o.queuedRunStatus = append(o.queuedRunStatus, o.runStatusMetrics(status, now)...)
+}
+
+// takeQueuedRunStatus returns the queued status transitions and clears the queue.
+func (o *Output) takeQueuedRunStatus() []dynatraceMetric {
+	queued := o.queuedRunStatus
+	o.queuedRunStatus = nil
+	return queued
+}
+
+// reportRunStatus sends a status transition of the test run as metric.
+// The events of the test start and end carry the status as well.
+func (o *Output) reportRunStatus(status runStatus, now time.Time) {
+	runStatusMetrics := o.runStatusMetrics(status, now)
+	if len(runStatusMetrics) == 0 {
+		return
+	}
+	if err := o.sendMetrics(runStatusMetrics); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the run status")
+	}
+}
@@ -0,0 +1,84 @@
+package dynatracewriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/errext"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestRunStatusFromError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err    error
+		status runStatus
+	}{
+		"finished":       {err: nil, status: runStatusFinished},
+		"user":           {err: errext.WithAbortReasonIfNone(errors.New("interrupted"), errext.AbortedByUser), status: runStatusAbortedByUser},
+		"threshold":      {err: errext.WithAbortReasonIfNone(errors.New("thresholds"), errext.AbortedByThreshold), status: runStatusAbortedByThreshold},
+		"threshold_end":  {err: errext.WithAbortReasonIfNone(errors.New("thresholds"), errext.AbortedByThresholdsAfterTestEnd), status: runStatusAbortedByThreshold},
+		"output":         {err: errext.WithAbortReasonIfNone(errors.New("output"), errext.AbortedByOutput), status: runStatusAbortedByOutput},
+		"wrapped":        {err: fmt.Errorf("run failed: %w", errext.WithAbortReasonIfNone(errors.New("timeout"), errext.AbortedByTimeout)), status: runStatusAbortedByTimeout},
+		"without_reason": {err: errors.New("unknown"), status: runStatusFailed},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, testCase.status, runStatusFromError(testCase.err))
+		})
+	}
+}
+
+func TestRunStatusMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.Dimensions = map[string]string{"test": "checkout"}
+	o := &Output{config: &c}
+
+	runStatusMetrics := o.runStatusMetrics(runStatusAbortedByThreshold, time.UnixMilli(1700000000000))
+	require.Len(t, runStatusMetrics, 1)
+	assert.Equal(t, map[string]string{"test": "checkout", "status": "aborted_by_threshold"}, runStatusMetrics[0].metricDimensions)
+	assert.Contains(t, runStatusMetrics[0].toText(), "k6.run.status,")
+}
+
+func TestQueuedRunStatus(t *testing.T) {
+	t.Parallel()
+
+	var received []string
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}, nil)
+
+	// queued at the start without a request, sent with the first flush
+	o.queueRunStatus(runStatusRunning, time.Now())
+	assert.Empty(t, received)
+	o.flush()
+	require.Len(t, received, 1)
+	assert.Contains(t, received[0], "k6.run.status,")
+	assert.Contains(t, received[0], `status="running"`)
+	o.flush()
+	assert.Len(t, received, 1)
+
+	c := NewConfig()
+	c.ExcludeMetrics = null.StringFrom("run.*")
+	filter, err := newMetricFilter(&c)
+	require.NoError(t, err)
+	o.metricFilter = filter
+	assert.Empty(t, o.runStatusMetrics(runStatusFinished, time.Now()))
+	o.reportRunStatus(runStatusFinished, time.Now())
+	assert.Len(t, received, 1)
+}
@@ -0,0 +1,90 @@
+package dynatracewriter
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// sketchRelativeAccuracy is the maximum relative error of the quantiles of a sketch
+	sketchRelativeAccuracy = 0.01
+	// sketchMaxBuckets bounds the memory of a sketch, the lowest buckets are merged beyond it
+	sketchMaxBuckets = 2048
+)
+
+var sketchGamma = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+
+// quantileSketch estimates quantiles in bounded memory, following DDSketch: values are counted in
+// logarithmic buckets, so every estimate is within sketchRelativeAccuracy of a value of the requested rank.
+// k6 trends are durations and sizes, values below or equal to zero are counted together as zero.
+type quantileSketch struct {
+	buckets map[int]uint64
+	zeros   uint64
+	count   uint64
+	min     float64
+	max     float64
+}
+
+func newQuantileSketch() *quantileSketch {
+	return &quantileSketch{buckets: make(map[int]uint64)}
+}
+
+func (s *quantileSketch) add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	if value <= 0 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(value)/math.Log(sketchGamma)))]++
+	if len(s.buckets) > sketchMaxBuckets {
+		s.collapseLowest()
+	}
+}
+
+// collapseLowest merges the two lowest buckets, sacrificing the accuracy of the lowest quantiles.
+func (s *quantileSketch) collapseLowest() {
+	indexes := s.sortedIndexes()
+	s.buckets[indexes[1]] += s.buckets[indexes[0]]
+	delete(s.buckets, indexes[0])
+}
+
+func (s *quantileSketch) sortedIndexes() []int {
+	indexes := make([]int, 0, len(s.buckets))
+	for i := range s.buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// quantile returns the estimated p-th percentile, p from 0 to 100.
+func (s *quantileSketch) quantile(p float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return s.min
+	}
+	if p >= 100 {
+		return s.max
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(s.count)))
+	seen := s.zeros
+	if seen >= rank {
+		return math.Max(s.min, 0)
+	}
+	for _, i := range s.sortedIndexes() {
+		seen += s.buckets[i]
+		if seen >= rank {
+			estimate := 2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)
+			return math.Min(math.Max(estimate, s.min), s.max)
+		}
+	}
+	return s.max
+}
@@ -0,0 +1,122 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	defaultBizEventsEndPoint = "/api/v2/bizevents/ingest"
+	summaryEventType         = "k6.test.summary"
+)
+
+// runSummary accumulates the samples the output has seen to summarize the test run at its end.
+type runSummary struct {
+	requests        float64
+	failedRequests  int
+	checkedRequests int
+	iterations      float64
+	maxVUs          float64
+	// durations are kept in a sketch, the memory does not grow with the length of the test run
+	durations *quantileSketch
+}
+
+// add accumulates the samples of one flush.
+func (s *runSummary) add(samplesContainers []metrics.SampleContainer) {
+	for _, samplesContainer := range samplesContainers {
+		for _, sample := range samplesContainer.GetSamples() {
+			switch sample.Metric.Name {
+			case "http_reqs":
+				s.requests += sample.Value
+			case "http_req_failed":
+				s.checkedRequests++
+				if sample.Value != 0 {
+					s.failedRequests++
+				}
+			case "http_req_duration":
+				if s.durations == nil {
+					s.durations = newQuantileSketch()
+				}
+				s.durations.add(sample.Value)
+			case "iterations":
+				s.iterations += sample.Value
+			case "vus":
+				if sample.Value > s.maxVUs {
+					s.maxVUs = sample.Value
+				}
+			}
+		}
+	}
+}
+
+// summaryEvent builds the business event summarizing the test run.
+func (o *Output) summaryEvent(end time.Time, status runStatus) map[string]interface{} {
+	event := map[string]interface{}{
+		"event.type":          summaryEventType,
+		"event.provider":      "k6",
+		"k6.test.run.id":      o.testRun.id,
+		"k6.run.status":       string(status),
+		"k6.start":            o.testRun.startTime.UTC().Format(time.RFC3339Nano),
+		"k6.end":              end.UTC().Format(time.RFC3339Nano),
+		"k6.duration.seconds": end.Sub(o.testRun.startTime).Seconds(),
+		"k6.http.requests":    o.summary.requests,
+		"k6.iterations":       o.summary.iterations,
+		"k6.vus.max":          o.summary.maxVUs,
+		"k6.vus.max.planned":  o.testRun.maxVUs,
+	}
+	if len(o.testRun.scriptPath) > 0 {
+		event["k6.script"] = o.testRun.scriptPath
+	}
+	if o.summary.checkedRequests > 0 {
+		event["k6.http.error.rate"] = float64(o.summary.failedRequests) / float64(o.summary.checkedRequests)
+	}
+	if o.summary.durations != nil {
+		for _, p := range []float64{50, 90, 95, 99} {
+			event[fmt.Sprintf("k6.http_req_duration.p%g", p)] = o.summary.durations.quantile(p)
+		}
+	}
+	results := o.thresholdResults()
+	if len(results) > 0 {
+		allPassed := true
+		failed := []string{}
+		for _, result := range results {
+			if !result.passed {
+				allPassed = false
+				failed = append(failed, result.metric+": "+result.threshold)
+			}
+		}
+		event["k6.thresholds.passed"] = allPassed
+		event["k6.thresholds.failed"] = failed
+	}
+	for k, v := range o.config.Dimensions {
+		if _, defined := event[k]; !defined {
+			event[k] = v
+		}
+	}
+	return event
+}
+
+// sendSummaryEvent posts the summary of the test run to the business events ingest.
+func (o *Output) sendSummaryEvent(event map[string]interface{}) error {
+	bizEventsUrl, err := o.config.apiUrl(defaultBizEventsEndPoint)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	o.logger.Debug("Summary event to send " + string(body))
+
+	response, err := o.post(bizEventsUrl, "application/json; charset=utf-8", body)
+	if err != nil {
+		return err
+	}
+	if response.statusCode >= 300 {
+		return fmt.Errorf("the business events ingest responded with %s: %s", response.status, string(response.body))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSummaryEvent(t *testing.T) {
+	t.Parallel()
+
+	var received map[string]interface{}
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/bizevents/ingest", r.URL.Path)
+		assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}, func(c *Config) {
+		c.SummaryEvent = null.BoolFrom(true)
+	})
+
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	o.testRun = testRun{id: "run-1", maxVUs: 20, startTime: start}
+	thresholds := metrics.NewThresholds([]string{"p(95)<500"})
+	thresholds.Thresholds[0].LastFailed = true
+	o.SetThresholds(map[string]metrics.Thresholds{"http_req_duration": thresholds})
+
+	registry := metrics.NewRegistry()
+	sample := func(name string, metricType metrics.MetricType, value float64) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(name, metricType), Tags: registry.RootTagSet()},
+			Time:       start,
+			Value:      value,
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		failed := 0.0
+		if i%10 == 0 {
+			failed = 1
+		}
+		o.summary.add([]metrics.SampleContainer{metrics.Samples{
+			sample("http_reqs", metrics.Counter, 1),
+			sample("http_req_failed", metrics.Rate, failed),
+			sample("http_req_duration", metrics.Trend, float64(i)),
+		}})
+	}
+	o.summary.add([]metrics.SampleContainer{metrics.Samples{
+		sample("iterations", metrics.Counter, 50), sample("vus", metrics.Gauge, 12), sample("vus", metrics.Gauge, 8),
+	}})
+
+	require.NoError(t, o.sendSummaryEvent(o.summaryEvent(start.Add(5*time.Minute), runStatusFinished)))
+	assert.Equal(t, "k6.test.summary", received["event.type"])
+	assert.Equal(t, "run-1", received["k6.test.run.id"])
+	assert.Equal(t, "finished", received["k6.run.status"])
+	assert.Equal(t, 300.0, received["k6.duration.seconds"])
+	assert.Equal(t, 100.0, received["k6.http.requests"])
+	assert.InDelta(t, 0.1, received["k6.http.error.rate"], 0.0001)
+	// estimated by the sketch, within its relative accuracy
+	assert.InEpsilon(t, 50, received["k6.http_req_duration.p50"], sketchRelativeAccuracy)
+	assert.InEpsilon(t, 95, received["k6.http_req_duration.p95"], sketchRelativeAccuracy)
+	assert.Equal(t, 50.0, received["k6.iterations"])
+	assert.Equal(t, 12.0, received["k6.vus.max"])
+	assert.Equal(t, 20.0, received["k6.vus.max.planned"])
+	assert.Equal(t, false, received["k6.thresholds.passed"])
+	assert.Equal(t, []interface{}{"http_req_duration: p(95)<500"}, received["k6.thresholds.failed"])
+}
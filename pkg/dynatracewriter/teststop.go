@@ -0,0 +1,50 @@
+package dynatracewriter
+
+import (
+	"errors"
+	"fmt"
+
+	"go.k6.io/k6/output"
+)
+
+var _ output.WithTestRunStop = new(Output)
+
+// errAuthentication marks requests the metrics ingest rejected with 401 or 403 because of the credentials,
+// they do not recover by retrying and stop the test run right away.
+var errAuthentication = errors.New("Dynatrace rejected the credentials")
+
+// SetTestRunStopCallback receives the function which stops the test run with an error.
+func (o *Output) SetTestRunStopCallback(stop func(error)) {
+	o.stopTestRun = stop
+}
+
+// recordFlush counts consecutive failed flushes and stops the test run once the metrics persistently
+// can not be ingested, so no load is generated without its results being stored.
+func (o *Output) recordFlush(err error) {
+	if err == nil {
+		o.failedFlushes = 0
+		return
+	}
+	o.failedFlushes++
+	o.logger.WithError(err).WithField("failedFlushes", o.failedFlushes).Error("Dynatrace: failed to send the metrics")
+
+	maxFailed := int(o.config.MaxFailedFlushes.Int64)
+	if maxFailed <= 0 || o.testRunStopped {
+		return
+	}
+	var stopErr error
+	switch {
+	case errors.Is(err, errAuthentication):
+		stopErr = fmt.Errorf("Stopping the test, Dynatrace can not ingest the metrics: %w", err)
+	case o.failedFlushes >= maxFailed:
+		stopErr = fmt.Errorf("Stopping the test, the last %d flushes to Dynatrace failed: %w", o.failedFlushes, err)
+	default:
+		return
+	}
+	o.testRunStopped = true
+	if o.stopTestRun == nil {
+		o.logger.Error("Dynatrace: " + stopErr.Error())
+		return
+	}
+	o.stopTestRun(stopErr)
+}
@@ -0,0 +1,109 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestStopTestRunOnFailedFlushes(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		statuses         []int
+		maxFailedFlushes int64
+		errString        string
+	}{
+		"accepted":                 {statuses: []int{202, 202, 202, 202}, maxFailedFlushes: 3},
+		"partially_rejected_lines": {statuses: []int{400, 400, 400, 400}, maxFailedFlushes: 3},
+		"recovers_in_between":      {statuses: []int{503, 503, 202, 503, 503}, maxFailedFlushes: 3},
+		"persistently_failing":     {statuses: []int{202, 503, 502, 503}, maxFailedFlushes: 3, errString: "the last 3 flushes to Dynatrace failed"},
+		"expired_token":            {statuses: []int{202, 401}, maxFailedFlushes: 3, errString: "Dynatrace rejected the credentials"},
+		"missing_scope":            {statuses: []int{403}, maxFailedFlushes: 3, errString: "Dynatrace rejected the credentials"},
+		"disabled":                 {statuses: []int{401, 503, 503, 503}, maxFailedFlushes: 0},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			request := 0
+			o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(testCase.statuses[request])
+				request++
+			}, func(c *Config) {
+				c.MaxFailedFlushes = null.IntFrom(testCase.maxFailedFlushes)
+				c.Retries = null.IntFrom(0)
+			})
+
+			var stopErrs []error
+			o.SetTestRunStopCallback(func(err error) { stopErrs = append(stopErrs, err) })
+			for range testCase.statuses {
+				o.recordFlush(o.sendMetrics([]dynatraceMetric{{metricKeyName: "vus", metricValue: 1}}))
+			}
+
+			if len(testCase.errString) == 0 {
+				assert.Empty(t, stopErrs)
+				return
+			}
+			require.Len(t, stopErrs, 1)
+			assert.ErrorContains(t, stopErrs[0], testCase.errString)
+		})
+	}
+}
+
+func TestTokenEndpointOutage(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		retries       int64
+		failedFlushes []int
+	}{
+		"retried":           {retries: 1, failedFlushes: []int{0, 0}},
+		"counted_as_failed": {retries: 0, failedFlushes: []int{1, 0}},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tokenRequests := 0
+			tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokenRequests++
+				if tokenRequests == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprint(w, `{"access_token":"sso-token","token_type":"Bearer","expires_in":300}`)
+			}))
+			defer tokenServer.Close()
+
+			o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Bearer sso-token", r.Header.Get("Authorization"))
+				w.WriteHeader(http.StatusAccepted)
+			}, func(c *Config) {
+				c.ApiToken = null.String{}
+				c.OAuthTokenUrl = null.StringFrom(tokenServer.URL)
+				c.OAuthClientId = null.StringFrom("client")
+				c.OAuthClientSecret = null.StringFrom("secret")
+				c.MaxFailedFlushes = null.IntFrom(3)
+				c.Retries = null.IntFrom(testCase.retries)
+			})
+
+			var stopErrs []error
+			o.SetTestRunStopCallback(func(err error) { stopErrs = append(stopErrs, err) })
+			for _, failedFlushes := range testCase.failedFlushes {
+				o.recordFlush(o.sendMetrics([]dynatraceMetric{{metricKeyName: "vus", metricValue: 1}}))
+				assert.Equal(t, failedFlushes, o.failedFlushes)
+			}
+			assert.Empty(t, stopErrs, "a short outage of the token endpoint does not stop the test")
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+)
+
+const thresholdPassedMetric = "threshold.passed"
+
+var _ output.WithThresholds = new(Output)
+
+// thresholdResult is the final status of one threshold expression of a metric.
+type thresholdResult struct {
+	metric    string
+	threshold string
+	passed    bool
+}
+
+// SetThresholds receives the thresholds of the script before the output is started.
+// The engine evaluates them on the same Threshold instances, so their final status can be read at Stop.
+func (o *Output) SetThresholds(thresholds map[string]metrics.Thresholds) {
+	o.thresholds = thresholds
+}
+
+// thresholdResults returns the status of all thresholds as the engine evaluated them last, sorted by metric.
+func (o *Output) thresholdResults() []thresholdResult {
+	var results []thresholdResult
+	for metric, thresholds := range o.thresholds {
+		for _, threshold := range thresholds.Thresholds {
+			results = append(results, thresholdResult{
+				metric:    metric,
+				threshold: threshold.Source,
+				passed:    !threshold.LastFailed,
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].metric != results[j].metric {
+			return results[i].metric < results[j].metric
+		}
+		return results[i].threshold < results[j].threshold
+	})
+	return results
+}
+
+// thresholdMetrics converts the threshold results to k6.threshold.passed gauges, 1 for passed and 0 for failed.
+// They are subject to the metric filter like the k6 metrics.
+func (o *Output) thresholdMetrics(results []thresholdResult, now time.Time) []dynatraceMetric {
+	if !o.metricFilter.allowsName(thresholdPassedMetric, metrics.Gauge) {
+		return nil
+	}
+	dynatraceMetrics := make([]dynatraceMetric, 0, len(results))
+	for _, result := range results {
+		dimensions := make(map[string]string, len(o.config.Dimensions)+2)
+		for k, v := range o.config.Dimensions {
+			dimensions[k] = v
+		}
+		dimensions["metric"] = result.metric
+		dimensions["threshold"] = result.threshold
+
+		value := 0.0
+		if result.passed {
+			value = 1
+		}
+		dynatraceMetrics = append(dynatraceMetrics, dynatraceMetric{
+			metricKeyPrefix:  o.config.MetricPrefix.String,
+			metricKeyName:    thresholdPassedMetric,
+			metricDimensions: dimensions,
+			metricValue:      value,
+			metricTimeStamp:  now.UnixMilli(),
+			metricType:       metrics.Gauge,
+		})
+	}
+	return dynatraceMetrics
+}
+
+// thresholdsEvent summarizes the threshold results of the test run in one event.
+func (o *Output) thresholdsEvent(results []thresholdResult, now time.Time) dynatraceEvent {
+	properties := o.testRun.properties()
+	allPassed := true
+	for _, result := range results {
+		status := "passed"
+		if !result.passed {
+			status = "failed"
+			allPassed = false
+		}
+		properties[fmt.Sprintf("k6.threshold.%s.%s", result.metric, result.threshold)] = status
+	}
+	properties["k6.thresholds.passed"] = strconv.FormatBool(allPassed)
+
+	title := fmt.Sprintf("k6 load test %s passed its thresholds", o.testRun.id)
+	if !allPassed {
+		title = fmt.Sprintf("k6 load test %s failed its thresholds", o.testRun.id)
+	}
+	return dynatraceEvent{
+		EventType:      o.config.EventType.String,
+		Title:          title,
+		StartTime:      o.testRun.startTime.UnixMilli(),
+		EndTime:        now.UnixMilli(),
+		EntitySelector: o.config.EventEntitySelector.String,
+		Properties:     properties,
+	}
+}
+
+// reportThresholds sends the final threshold results as metrics and, with events enabled, as an event.
+func (o *Output) reportThresholds() {
+	results := o.thresholdResults()
+	if !o.config.ThresholdResults.Bool || len(results) == 0 {
+		return
+	}
+	now := time.Now()
+	if thresholdMetrics := o.thresholdMetrics(results, now); len(thresholdMetrics) > 0 {
+		if err := o.sendMetrics(thresholdMetrics); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the threshold results")
+		}
+	}
+	if o.config.Events.Bool {
+		if err := o.sendEvent(o.thresholdsEvent(results, now)); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the thresholds event")
+		}
+	}
+}
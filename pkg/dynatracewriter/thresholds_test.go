@@ -0,0 +1,154 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestThresholdResults(t *testing.T) {
+	t.Parallel()
+
+	duration := metrics.NewThresholds([]string{"p(95)<500", "avg<200"})
+	duration.Thresholds[0].LastFailed = true
+	failed := metrics.NewThresholds([]string{"rate<0.01"})
+
+	c := NewConfig()
+	c.Dimensions = map[string]string{"test": "checkout"}
+	o := &Output{config: &c, testRun: testRun{id: "run-1"}}
+	o.SetThresholds(map[string]metrics.Thresholds{"http_req_duration": duration, "http_req_failed": failed})
+
+	results := o.thresholdResults()
+	assert.Equal(t, []thresholdResult{
+		{metric: "http_req_duration", threshold: "avg<200", passed: true},
+		{metric: "http_req_duration", threshold: "p(95)<500", passed: false},
+		{metric: "http_req_failed", threshold: "rate<0.01", passed: true},
+	}, results)
+
+	now := time.Now()
+	thresholdMetrics := o.thresholdMetrics(results, now)
+	require.Len(t, thresholdMetrics, 3)
+	assert.Equal(t, 0.0, thresholdMetrics[1].metricValue)
+	assert.Equal(t, map[string]string{"test": "checkout", "metric": "http_req_duration", "threshold": "p(95)<500"},
+		thresholdMetrics[1].metricDimensions)
+	assert.Contains(t, thresholdMetrics[0].toText(), "k6.threshold.passed,")
+
+	event := o.thresholdsEvent(results, now)
+	assert.Equal(t, "k6 load test run-1 failed its thresholds", event.Title)
+	assert.Equal(t, "false", event.Properties["k6.thresholds.passed"])
+	assert.Equal(t, "failed", event.Properties["k6.threshold.http_req_duration.p(95)<500"])
+}
+
+func TestParseThresholdExpression(t *testing.T) {
+	t.Parallel()
+
+	e, err := parseThresholdExpression("p(95)<500")
+	require.NoError(t, err)
+	assert.Equal(t, thresholdExpression{method: "p", percentile: 95, operator: "<", value: 500}, e)
+
+	e, err = parseThresholdExpression(" rate >= 0.01 ")
+	require.NoError(t, err)
+	assert.Equal(t, thresholdExpression{method: "rate", operator: ">=", value: 0.01}, e)
+	assert.True(t, e.passes(0.5))
+	assert.False(t, e.passes(0.001))
+
+	_, err = parseThresholdExpression("p95<500")
+	assert.ErrorContains(t, err, "unsupported threshold expression")
+}
+
+func TestFlushAggregateOfTrend(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	aggregate := &flushAggregate{metricType: metrics.Trend}
+	for i := 1; i <= 100000; i++ {
+		aggregate.add(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration}, Value: float64(i)})
+	}
+
+	expectations := map[string]float64{"count<1": 100000, "med<1": 50000, "p(99)<1": 99000, "max<1": 100000}
+	for source, expected := range expectations {
+		e, err := parseThresholdExpression(source)
+		require.NoError(t, err)
+		observed, ok := aggregate.value(e, time.Second)
+		require.True(t, ok, source)
+		assert.InEpsilon(t, expected, observed, sketchRelativeAccuracy, source)
+	}
+	e, err := parseThresholdExpression("rate<1")
+	require.NoError(t, err)
+	_, ok := aggregate.value(e, time.Second)
+	assert.False(t, ok)
+	assert.LessOrEqual(t, len(aggregate.sketch.buckets), sketchMaxBuckets)
+}
+
+func TestLiveThresholdEvaluation(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend, metrics.Time)
+	failed := registry.MustNewMetric("http_req_failed", metrics.Rate)
+	sample := func(m *metrics.Metric, value float64, tags map[string]string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: m, Tags: registry.RootTagSet().WithTagsFromMap(tags)},
+			Time:       time.Now(),
+			Value:      value,
+		}
+	}
+
+	evaluator, errs := newThresholdEvaluator(map[string]metrics.Thresholds{
+		"http_req_duration{status:200}": metrics.NewThresholds([]string{"p(95)<500"}),
+		"http_req_failed":               metrics.NewThresholds([]string{"rate<0.1"}),
+	})
+	require.Empty(t, errs)
+
+	start := time.Now()
+	window := func(i int) (time.Time, time.Time) {
+		return start.Add(time.Duration(i) * time.Second), start.Add(time.Duration(i+1) * time.Second)
+	}
+
+	// all passing, nothing changes
+	from, to := window(0)
+	transitions := evaluator.evaluate([]metrics.SampleContainer{metrics.Samples{
+		sample(duration, 100, map[string]string{"status": "200"}),
+		sample(duration, 2000, map[string]string{"status": "500"}),
+		sample(failed, 0, nil),
+	}}, from, to)
+	assert.Empty(t, transitions)
+
+	// slow responses, the duration threshold starts failing
+	from, to = window(1)
+	transitions = evaluator.evaluate([]metrics.SampleContainer{metrics.Samples{
+		sample(duration, 100, map[string]string{"status": "200"}),
+		sample(duration, 900, map[string]string{"status": "200"}),
+		sample(failed, 0, nil),
+	}}, from, to)
+	require.Len(t, transitions, 1)
+	assert.Equal(t, "http_req_duration{status:200}", transitions[0].threshold.metric)
+	assert.True(t, transitions[0].failing)
+	assert.InEpsilon(t, 900, transitions[0].observed, sketchRelativeAccuracy)
+	assert.Equal(t, from, transitions[0].windowStart)
+
+	// still failing, no new transition; errors start failing the rate threshold
+	from, to = window(2)
+	transitions = evaluator.evaluate([]metrics.SampleContainer{metrics.Samples{
+		sample(duration, 800, map[string]string{"status": "200"}),
+		sample(failed, 1, nil),
+		sample(failed, 0, nil),
+	}}, from, to)
+	require.Len(t, transitions, 1)
+	assert.Equal(t, "http_req_failed", transitions[0].threshold.metric)
+	assert.InDelta(t, 0.5, transitions[0].observed, 0.001)
+
+	// recovered
+	from, to = window(3)
+	transitions = evaluator.evaluate([]metrics.SampleContainer{metrics.Samples{
+		sample(duration, 100, map[string]string{"status": "200"}),
+		sample(failed, 0, nil),
+	}}, from, to)
+	require.Len(t, transitions, 2)
+	assert.False(t, transitions[0].failing)
+	assert.False(t, transitions[1].failing)
+}
@@ -0,0 +1,102 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redactedValue = "[REDACTED]"
+
+// apiTokenFile reads the API token from a file and re-reads it whenever the file changes,
+// so that a rotated Kubernetes secret mounted as a volume is picked up without restarting the test.
+type apiTokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func newApiTokenFile(path string) (*apiTokenFile, error) {
+	f := &apiTokenFile{path: path}
+	if _, err := f.Token(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Token returns the current content of the token file, trimmed from surrounding whitespace.
+func (f *apiTokenFile) Token() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("The Dynatrace API token file can not be read: %w", err)
+	}
+	if len(f.token) > 0 && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("The Dynatrace API token file can not be read: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if len(token) == 0 {
+		return "", fmt.Errorf("The Dynatrace API token file %s is empty", f.path)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return f.token, nil
+}
+
+// isSensitiveHeader reports whether the value of a header must never be logged.
+func isSensitiveHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+		return true
+	}
+	return false
+}
+
+// redactToken keeps only the scheme and the public token identifier (dt0c01.<id>) of an authorization value.
+func redactToken(value string) string {
+	scheme, token, hasScheme := strings.Cut(value, " ")
+	if !hasScheme {
+		token, scheme = scheme, ""
+	}
+	redacted := redactedValue
+	if parts := strings.SplitN(token, ".", 3); len(parts) == 3 && strings.HasPrefix(parts[0], "dt0") {
+		redacted = parts[0] + "." + parts[1] + "." + redactedValue
+	}
+	if len(scheme) > 0 {
+		return scheme + " " + redacted
+	}
+	return redacted
+}
+
+// headersToLog formats headers one per line with the values of sensitive headers redacted.
+func headersToLog(headers http.Header) string {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			if isSensitiveHeader(key) {
+				value = redactToken(value)
+			}
+			b.WriteString(key + "=" + value + "\n")
+		}
+	}
+	return b.String()
+}
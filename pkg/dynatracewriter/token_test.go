@@ -0,0 +1,58 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestApiTokenFileReload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("dt0c01.FIRST.secret\n"), 0o600))
+
+	f, err := newApiTokenFile(path)
+	require.NoError(t, err)
+	token, err := f.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "dt0c01.FIRST.secret", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("dt0c01.SECOND.rotated-secret"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	token, err = f.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "dt0c01.SECOND.rotated-secret", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("  "), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	_, err = f.Token()
+	assert.ErrorContains(t, err, "is empty")
+
+	_, err = newApiTokenFile(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "can not be read")
+}
+
+func TestTokenRedaction(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "Api-Token dt0c01.ABC.[REDACTED]", redactToken("Api-Token dt0c01.ABC.verysecret"))
+	assert.Equal(t, "Bearer [REDACTED]", redactToken("Bearer eyJhbGciOi"))
+	assert.Equal(t, "[REDACTED]", redactToken("plain"))
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Api-Token dt0c01.ABC.verysecret")
+	headers.Set("Content-Type", "text/plain")
+	assert.Equal(t, "Authorization=Api-Token dt0c01.ABC.[REDACTED]\nContent-Type=text/plain\n", headersToLog(headers))
+
+	c := NewConfig()
+	c.ApiToken = null.StringFrom("dt0c01.ABC.verysecret")
+	c.Headers["Authorization"] = "Api-Token dt0c01.ABC.verysecret"
+	assert.NotContains(t, c.String(), "verysecret")
+}
@@ -0,0 +1,231 @@
+package dynatracewriter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.k6.io/k6/metrics"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultOtlpTraceEndPoint = "/api/v2/otlp/v1/traces"
+	// maxTracedRequestsPerFlush bounds the spans sent per flush, the requests above it are not traced
+	maxTracedRequestsPerFlush = 1000
+)
+
+type requestPhase struct {
+	metric string
+	span   string
+}
+
+// requestPhases are the timings of an HTTP request in the order they happen, they add up to the whole request.
+var requestPhases = []requestPhase{
+	{"http_req_blocked", "blocked"},
+	{"http_req_sending", "sending"},
+	{"http_req_waiting", "waiting"},
+	{"http_req_receiving", "receiving"},
+}
+
+// connectionPhases are the timings of opening a new connection, in the order they happen.
+// k6 counts them in http_req_blocked, so they are laid out at the end of the blocked span as its children.
+var connectionPhases = []requestPhase{
+	{"http_req_connecting", "connecting"},
+	{"http_req_tls_handshaking", "tls handshaking"},
+}
+
+// requestSpanTags are the request tags set as span attributes, the status code is set as integer.
+var requestSpanTags = map[string]string{
+	"url":        "http.url",
+	"method":     "http.method",
+	"proto":      "http.flavor",
+	"error_code": "k6.error_code",
+	"scenario":   "k6.scenario",
+	"group":      "k6.group",
+	"name":       "k6.name",
+}
+
+// randomId returns n random bytes, used as trace and span ids.
+func randomId(n int) []byte {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+	return id
+}
+
+// traceId uses the trace id k6 attached to the request, if any, so the span joins the trace of the system under test.
+func traceId(metadata map[string]string) []byte {
+	if id, err := hex.DecodeString(metadata["trace_id"]); err == nil && len(id) == 16 {
+		return id
+	}
+	return randomId(16)
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// requestSpans reconstructs the timeline of one HTTP request from the samples of its container:
+// a client span for the whole request with a child span for every phase which took any time.
+// The samples end at the end of the request, the phases are laid out backwards from there.
+func requestSpans(request metrics.Sample, samples []metrics.Sample) []*tracepb.Span {
+	phases := make(map[string]time.Duration, len(requestPhases)+len(connectionPhases))
+	for _, sample := range samples {
+		phases[sample.Metric.Name] = time.Duration(sample.Value * float64(time.Millisecond))
+	}
+	total := time.Duration(0)
+	for _, phase := range requestPhases {
+		total += phases[phase.metric]
+	}
+	end := request.Time
+	start := end.Add(-total)
+
+	tags := request.GetTags().Map()
+	attributes := []*commonpb.KeyValue{}
+	for tag, attribute := range requestSpanTags {
+		if v, ok := tags[tag]; ok && len(v) > 0 {
+			attributes = append(attributes, stringAttribute(attribute, v))
+		}
+	}
+	if status, err := strconv.ParseInt(tags["status"], 10, 64); err == nil {
+		attributes = append(attributes, &commonpb.KeyValue{
+			Key: "http.status_code", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: status}},
+		})
+	}
+	sortAttributes(attributes)
+
+	name := tags["method"]
+	if len(tags["name"]) > 0 {
+		name += " " + tags["name"]
+	}
+	parent := &tracepb.Span{
+		TraceId:           traceId(request.Metadata),
+		SpanId:            randomId(8),
+		Name:              name,
+		Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        attributes,
+		Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK},
+	}
+	if isFailedRequest(tags) {
+		parent.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: tags["error"]}
+	}
+
+	spans := []*tracepb.Span{parent}
+	phaseStart := start
+	for _, phase := range requestPhases {
+		duration := phases[phase.metric]
+		if duration <= 0 {
+			continue
+		}
+		span := phaseSpan(parent, parent, phase.span, phaseStart, phaseStart.Add(duration))
+		spans = append(spans, span)
+		phaseStart = phaseStart.Add(duration)
+
+		if phase.metric != "http_req_blocked" {
+			continue
+		}
+		connection := time.Duration(0)
+		for _, child := range connectionPhases {
+			connection += phases[child.metric]
+		}
+		childStart := phaseStart.Add(-connection)
+		if childStart.Before(start) {
+			childStart = start
+		}
+		for _, child := range connectionPhases {
+			duration := phases[child.metric]
+			if duration <= 0 {
+				continue
+			}
+			spans = append(spans, phaseSpan(parent, span, child.span, childStart, childStart.Add(duration)))
+			childStart = childStart.Add(duration)
+		}
+	}
+	return spans
+}
+
+// phaseSpan returns the internal span of one phase of the request, a child of the given span.
+func phaseSpan(request, parent *tracepb.Span, name string, start, end time.Time) *tracepb.Span {
+	return &tracepb.Span{
+		TraceId:           request.TraceId,
+		SpanId:            randomId(8),
+		ParentSpanId:      parent.SpanId,
+		Name:              name,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+	}
+}
+
+// requestTraces groups the samples of the flush per HTTP request and converts each request to spans.
+func (o *Output) requestTraces(samplesContainers []metrics.SampleContainer) []*tracepb.Span {
+	var (
+		spans   []*tracepb.Span
+		traced  int
+		skipped int
+	)
+	for _, samplesContainer := range samplesContainers {
+		samples := samplesContainer.GetSamples()
+		for _, sample := range samples {
+			if sample.Metric.Name != "http_reqs" {
+				continue
+			}
+			if traced >= maxTracedRequestsPerFlush {
+				skipped++
+				continue
+			}
+			traced++
+			spans = append(spans, requestSpans(sample, samples)...)
+		}
+	}
+	if skipped > 0 {
+		warnOnce(o.logger, fmt.Sprintf("More than %d requests in one flush, the others are not traced", maxTracedRequestsPerFlush))
+	}
+	return spans
+}
+
+// exportTraces sends the spans of the HTTP requests of the flush to the OpenTelemetry trace ingest.
+func (o *Output) exportTraces(samplesContainers []metrics.SampleContainer) {
+	if !o.config.Traces.Bool {
+		return
+	}
+	spans := o.requestTraces(samplesContainers)
+	if len(spans) == 0 {
+		return
+	}
+	if err := o.sendSpans(spans); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the request traces")
+	}
+}
+
+func (o *Output) sendSpans(spans []*tracepb.Span) error {
+	tracesUrl, err := o.config.apiUrl(defaultOtlpTraceEndPoint)
+	if err != nil {
+		return err
+	}
+	// TracesData has the same wire format as the ExportTraceServiceRequest the endpoint expects
+	payload, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource: o.otlpResource(),
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Scope: &commonpb.InstrumentationScope{Name: otlpScopeName},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+	response, err := o.post(tracesUrl, "application/x-protobuf", payload)
+	if err != nil {
+		return err
+	}
+	if response.statusCode >= 300 {
+		return fmt.Errorf("the trace ingest responded with %s: %s", response.status, string(response.body))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package dynatracewriter
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestExportTraces(t *testing.T) {
+	t.Parallel()
+
+	var received tracepb.TracesData
+	o := newTestOutput(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/otlp/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(body, &received))
+	}, func(c *Config) {
+		c.Traces = null.BoolFrom(true)
+	})
+	o.testRun = testRun{id: "run-1"}
+
+	registry := metrics.NewRegistry()
+	end := time.Date(2026, 10, 19, 12, 0, 1, 0, time.UTC)
+	tags := registry.RootTagSet().WithTagsFromMap(map[string]string{
+		"url": "https://shop.example.com/checkout", "method": "POST", "status": "503", "name": "checkout",
+		"scenario": "buyers", "expected_response": "false",
+	})
+	sample := func(name string, metricType metrics.MetricType, value float64) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(name, metricType), Tags: tags},
+			Time:       end,
+			Value:      value,
+			Metadata:   map[string]string{"trace_id": "0af7651916cd43dd8448eb211c80319c"},
+		}
+	}
+	o.exportTraces([]metrics.SampleContainer{metrics.Samples{
+		sample("http_reqs", metrics.Counter, 1),
+		sample("http_req_duration", metrics.Trend, 350),
+		sample("http_req_blocked", metrics.Trend, 60),
+		sample("http_req_connecting", metrics.Trend, 40),
+		sample("http_req_tls_handshaking", metrics.Trend, 15),
+		sample("http_req_sending", metrics.Trend, 50),
+		sample("http_req_waiting", metrics.Trend, 200),
+		sample("http_req_receiving", metrics.Trend, 100),
+	}})
+
+	require.Len(t, received.ResourceSpans, 1)
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 7, "the request and its phases which took any time")
+
+	request := spans[0]
+	assert.Equal(t, "POST checkout", request.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, request.Kind)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", hex.EncodeToString(request.TraceId))
+	assert.Equal(t, uint64(end.Add(-410*time.Millisecond).UnixNano()), request.StartTimeUnixNano)
+	assert.Equal(t, uint64(end.UnixNano()), request.EndTimeUnixNano)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, request.Status.Code)
+	attributes := map[string]interface{}{}
+	for _, attribute := range request.Attributes {
+		if attribute.Key == "http.status_code" {
+			attributes[attribute.Key] = attribute.Value.GetIntValue()
+		} else {
+			attributes[attribute.Key] = attribute.Value.GetStringValue()
+		}
+	}
+	assert.Equal(t, map[string]interface{}{
+		"http.url": "https://shop.example.com/checkout", "http.method": "POST", "http.status_code": int64(503),
+		"k6.name": "checkout", "k6.scenario": "buyers",
+	}, attributes)
+
+	names := []string{}
+	for _, phase := range spans[1:] {
+		assert.Equal(t, request.TraceId, phase.TraceId)
+		names = append(names, phase.Name)
+	}
+	assert.Equal(t, []string{"blocked", "connecting", "tls handshaking", "sending", "waiting", "receiving"}, names)
+	blocked, connecting, tls, sending, waiting, receiving := spans[1], spans[2], spans[3], spans[4], spans[5], spans[6]
+	for _, phase := range []*tracepb.Span{blocked, sending, waiting, receiving} {
+		assert.Equal(t, request.SpanId, phase.ParentSpanId)
+	}
+	assert.Equal(t, blocked.SpanId, connecting.ParentSpanId, "the connection is opened while blocked")
+	assert.Equal(t, blocked.SpanId, tls.ParentSpanId)
+
+	assert.Equal(t, request.StartTimeUnixNano, blocked.StartTimeUnixNano)
+	assert.Equal(t, uint64(end.Add(-405*time.Millisecond).UnixNano()), connecting.StartTimeUnixNano)
+	assert.Equal(t, connecting.EndTimeUnixNano, tls.StartTimeUnixNano)
+	assert.Equal(t, blocked.EndTimeUnixNano, tls.EndTimeUnixNano)
+	assert.Equal(t, blocked.EndTimeUnixNano, sending.StartTimeUnixNano)
+	assert.Equal(t, sending.EndTimeUnixNano, waiting.StartTimeUnixNano)
+	assert.Equal(t, uint64(200*time.Millisecond), waiting.EndTimeUnixNano-waiting.StartTimeUnixNano)
+	assert.Equal(t, request.EndTimeUnixNano, receiving.EndTimeUnixNano)
+}
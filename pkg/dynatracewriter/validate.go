@@ -0,0 +1,231 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// metricPrefixPattern follows the Dynatrace metric key grammar: dot separated sections,
+// the first one starting with a letter or an underscore.
+var metricPrefixPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*(\.[a-zA-Z0-9_-]+)*$`)
+
+// ValidationErrors holds all the problems found in a config.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, "- "+err.Error())
+	}
+	return fmt.Sprintf("The Dynatrace output config is invalid:\n%s", strings.Join(messages, "\n"))
+}
+
+// Validate checks the whole config and reports all the problems at once.
+func (conf Config) Validate() error {
+	var errs ValidationErrors
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	mode, err := conf.endpointMode()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, conf.validateUrl(mode)...)
+	}
+
+	authType, err := conf.authType()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		if authType == AuthTypeNone && mode.requiresApiToken() {
+			addf("The Dynatrace API token can not been empty or Null for the %s endpoint mode", mode)
+		}
+		if err := conf.validateAuth(authType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if window := time.Duration(conf.AggregationWindow.Duration); window < 0 || (window > 0 && window%time.Second != 0) {
+		addf("The aggregation window must be a whole number of seconds, got %s", conf.AggregationWindow.String())
+	} else if window > 0 && window < time.Duration(conf.FlushPeriod.Duration) {
+		addf("The aggregation window %s must not be shorter than the flush period %s", conf.AggregationWindow.String(), conf.FlushPeriod.String())
+	}
+
+	if _, err := ParseProtocol(conf.Protocol.String); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !conf.FlushPeriod.Valid || time.Duration(conf.FlushPeriod.Duration) <= 0 {
+		addf("The flush period must be greater than 0, got %s", conf.FlushPeriod.String())
+	}
+
+	if _, err := newMetricFilter(&conf); err != nil {
+		addf("The metric filter is invalid: %v", err)
+	}
+	if conf.MaxSeriesPerMetric.Int64 < 0 {
+		addf("The maximum of series per metric must not be negative, got %d", conf.MaxSeriesPerMetric.Int64)
+	}
+	if conf.MaxFailedFlushes.Int64 < 0 {
+		addf("The maximum of consecutive failed flushes must not be negative, got %d", conf.MaxFailedFlushes.Int64)
+	}
+
+	if conf.Retries.Int64 < 0 {
+		addf("The number of retries must not be negative, got %d", conf.Retries.Int64)
+	}
+
+	for name := range conf.Headers {
+		if !isValidHeaderName(name) {
+			addf("The header name %q is invalid", name)
+		}
+	}
+
+	if len(conf.CACert.String) > 0 {
+		if info, err := os.Stat(conf.CACert.String); err != nil {
+			addf("The CA certificate file can not be read: %v", err)
+		} else if info.IsDir() {
+			addf("The CA certificate file %s is a directory", conf.CACert.String)
+		}
+	}
+
+	if len(conf.ApiTokenFile.String) > 0 {
+		if _, err := os.Stat(conf.ApiTokenFile.String); err != nil {
+			addf("The Dynatrace API token file can not be read: %v", err)
+		}
+	}
+
+	if conf.TrendPercentiles.Bool {
+		if _, err := parsePercentiles(conf.Percentiles.String); err != nil {
+			addf("The percentiles are invalid: %v", err)
+		}
+		if format := PercentileFormat(conf.PercentileFormat.String); format != PercentileFormatKey && format != PercentileFormatDimension {
+			addf("The percentile format %q is invalid, expected %s or %s", conf.PercentileFormat.String, PercentileFormatKey, PercentileFormatDimension)
+		}
+	}
+
+	for metric, boundaries := range conf.HistogramBuckets {
+		if _, err := parseBoundaries(boundaries); err != nil {
+			addf("The histogram buckets of %s are invalid: %v", metric, err)
+		}
+	}
+	if counts := HistogramCounts(conf.HistogramCounts.String); counts != HistogramCountsCumulative && counts != HistogramCountsDelta {
+		addf("The histogram counts %q are invalid, expected %s or %s", conf.HistogramCounts.String, HistogramCountsCumulative, HistogramCountsDelta)
+	}
+
+	if conf.Apdex.Bool {
+		global := fmt.Sprintf("%s,%s", conf.ApdexSatisfied.String(), conf.ApdexTolerating.String())
+		if _, err := parseApdexThresholds(global); err != nil {
+			addf("The Apdex thresholds are invalid: %v", err)
+		}
+		for name, thresholds := range conf.ApdexThresholds {
+			if _, err := parseApdexThresholds(thresholds); err != nil {
+				addf("The Apdex thresholds of %s are invalid: %v", name, err)
+			}
+		}
+	}
+
+	if !metricPrefixPattern.MatchString(conf.MetricPrefix.String) {
+		addf("The metric prefix %q is invalid, it must consist of dot separated sections of letters, digits, "+
+			"'_' and '-' and start with a letter or '_'", conf.MetricPrefix.String)
+	}
+
+	if conf.Events.Bool || conf.LiveThresholds.Bool {
+		if mode != EndpointModeSaaS && mode != EndpointModeActiveGate {
+			addf("Events can only be sent in the %s and %s endpoint modes", EndpointModeSaaS, EndpointModeActiveGate)
+		}
+		if !containsString(eventTypes, conf.EventType.String) {
+			addf("The event type %q is invalid, expected one of %s", conf.EventType.String, strings.Join(eventTypes, ", "))
+		}
+	}
+
+	if conf.SummaryEvent.Bool && mode != EndpointModeSaaS && mode != EndpointModeActiveGate {
+		addf("The summary event can only be sent in the %s and %s endpoint modes", EndpointModeSaaS, EndpointModeActiveGate)
+	}
+	if conf.Traces.Bool && mode != EndpointModeSaaS && mode != EndpointModeActiveGate {
+		addf("Traces can only be sent in the %s and %s endpoint modes", EndpointModeSaaS, EndpointModeActiveGate)
+	}
+	if conf.Logs.Bool || conf.FailedRequests.Bool {
+		if mode != EndpointModeSaaS && mode != EndpointModeActiveGate {
+			addf("Logs can only be sent in the %s and %s endpoint modes", EndpointModeSaaS, EndpointModeActiveGate)
+		}
+	}
+	if conf.Logs.Bool && !containsString(logLevels, conf.LogLevel.String) {
+		addf("The log level %q is invalid, expected one of %s", conf.LogLevel.String, strings.Join(logLevels, ", "))
+	}
+	if conf.FailedRequests.Bool {
+		if rate := conf.FailedRequestsSampleRate.Float64; rate <= 0 || rate > 1 {
+			addf("The sample rate of failed requests must be greater than 0 and at most 1, got %g", rate)
+		}
+		if conf.FailedRequestsPerFlush.Int64 <= 0 {
+			addf("The failed requests per flush must be greater than 0, got %d", conf.FailedRequestsPerFlush.Int64)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateUrl checks the configured URL against what the endpoint mode expects.
+func (conf Config) validateUrl(mode EndpointMode) []error {
+	if len(conf.Url.String) == 0 {
+		if mode != EndpointModeOneAgent {
+			return []error{fmt.Errorf("The Dynatrace URL is required for the %s endpoint mode", mode)}
+		}
+		return nil
+	}
+
+	u, err := url.Parse(conf.Url.String)
+	if err != nil {
+		return []error{fmt.Errorf("The Dynatrace URL is invalid: %w", err)}
+	}
+
+	var errs []error
+	if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("The Dynatrace URL %s must start with http:// or https://", conf.Url.String))
+	} else if len(u.Host) == 0 {
+		errs = append(errs, fmt.Errorf("The Dynatrace URL %s has no host", conf.Url.String))
+	}
+	if mode != EndpointModeCustomPath {
+		path := strings.TrimSuffix(u.Path, "/")
+		for _, endpoint := range []string{defaultDynatraceMetricEndPoint, defaultOneAgentMetricEndPoint,
+			defaultOtlpMetricEndPoint, defaultOneAgentOtlpMetricEndPoint} {
+			if strings.HasSuffix(path, endpoint) {
+				errs = append(errs, fmt.Errorf("The Dynatrace URL %s already contains the ingest path %s which is appended "+
+					"automatically, remove it or use the %s endpoint mode", conf.Url.String, endpoint, EndpointModeCustomPath))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidHeaderName reports whether name is a valid HTTP header field name (RFC 7230 token).
+func isValidHeaderName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}